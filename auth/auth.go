@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrUnauthorized means the caller didn't identify itself and the route
+	// requires it.
+	ErrUnauthorized = errors.New("authentication required")
+	// ErrForbidden means the caller is known but isn't allowed on the route.
+	ErrForbidden = errors.New("not allowed")
+)
+
+// Principal is who made a request, as far as the agent can tell.
+type Principal struct {
+	// Token is the name of the valid bearer token the caller presented.
+	Token string
+	// Local is set when the caller connected over the Unix socket and its
+	// user and groups are known.
+	Local bool
+	UID   int
+	// GIDs holds the caller's primary group followed by any supplementary
+	// groups.
+	GIDs []int
+}
+
+// Authorizer decides whether p may make r. It returns ErrUnauthorized or
+// ErrForbidden when it may not.
+type Authorizer interface {
+	Authorize(r *http.Request, p Principal) error
+}
+
+// Guard identifies the caller of every request and checks it with an
+// Authorizer before passing the request on. Its tokens and authorizer can be
+// replaced while it's serving.
+type Guard struct {
+	mu         sync.RWMutex
+	tokens     Tokens
+	authorizer Authorizer
+}
+
+func NewGuard(tokens Tokens, authorizer Authorizer) *Guard {
+	return &Guard{tokens: tokens, authorizer: authorizer}
+}
+
+// Set replaces the tokens and authorizer used for new requests.
+func (g *Guard) Set(tokens Tokens, authorizer Authorizer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tokens = tokens
+	g.authorizer = authorizer
+}
+
+// ServeHTTP implements negroni.Handler.
+func (g *Guard) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	g.mu.RLock()
+	tokens, authorizer := g.tokens, g.authorizer
+	g.mu.RUnlock()
+
+	p := identify(r, tokens)
+	err := authorizer.Authorize(r, p)
+	if err == nil {
+		next(rw, r)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":  r.URL.Path,
+		"token": p.Token,
+		"local": p.Local,
+		"uid":   p.UID,
+	}).Info("Denied request")
+
+	if err == ErrUnauthorized {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="propsd"`)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	rw.WriteHeader(http.StatusForbidden)
+}
+
+// identify builds the principal for r from its bearer token and, for Unix
+// socket connections, the peer credentials.
+func identify(r *http.Request, tokens Tokens) Principal {
+	p := Principal{UID: -1}
+
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		if name, ok := tokens.Lookup(strings.TrimPrefix(header, "Bearer ")); ok {
+			p.Token = name
+		}
+	}
+
+	if cred, ok := r.Context().Value(peerKey{}).(credentials); ok {
+		p.Local = true
+		p.UID = cred.UID
+		p.GIDs = append([]int{cred.GID}, supplementaryGroups(cred.UID, cred.GID)...)
+	}
+
+	return p
+}
+
+// supplementaryGroups returns the groups uid belongs to other than its
+// primary group gid. Users that can't be looked up only have their primary
+// group.
+func supplementaryGroups(uid, gid int) []int {
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+
+	var gids []int
+	for _, id := range ids {
+		if n, err := strconv.Atoi(id); err == nil && n != gid {
+			gids = append(gids, n)
+		}
+	}
+	return gids
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	tokens := Tokens{"s3cret": "ops", "other": "deploy"}
+
+	// A uid no account has, so only the primary group is known.
+	const uid, gid = 4242424, 4242425
+	local := context.WithValue(context.Background(), peerKey{}, credentials{UID: uid, GID: gid})
+
+	tests := []struct {
+		name   string
+		header string
+		ctx    context.Context
+		want   Principal
+	}{
+		{"no token", "", context.Background(), Principal{UID: -1}},
+		{"valid token", "Bearer s3cret", context.Background(), Principal{Token: "ops", UID: -1}},
+		{"unknown token", "Bearer guess", context.Background(), Principal{UID: -1}},
+		{"empty token", "Bearer ", context.Background(), Principal{UID: -1}},
+		{"token prefix", "Bearer s3cre", context.Background(), Principal{UID: -1}},
+		{"other scheme", "Basic s3cret", context.Background(), Principal{UID: -1}},
+		{"bare token", "s3cret", context.Background(), Principal{UID: -1}},
+		{"local without a token", "", local, Principal{Local: true, UID: uid, GIDs: []int{gid}}},
+		{"local with a token", "Bearer other", local, Principal{Token: "deploy", Local: true, UID: uid, GIDs: []int{gid}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/metadata", nil).WithContext(tt.ctx)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			if got := identify(r, tokens); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("identify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuard(t *testing.T) {
+	rules := &Rules{
+		rules: []rule{{
+			routes: []string{"/v1/admin/*"},
+			tokens: map[string]bool{"ops": true},
+			uids:   map[int]bool{},
+			gids:   map[int]bool{},
+		}},
+	}
+	guard := NewGuard(Tokens{"s3cret": "ops", "other": "deploy"}, rules)
+	next := func(rw http.ResponseWriter, r *http.Request) { rw.WriteHeader(http.StatusNoContent) }
+
+	tests := []struct {
+		name          string
+		path          string
+		header        string
+		want          int
+		authenticated bool
+	}{
+		{"allowed", "/v1/admin/refresh", "Bearer s3cret", http.StatusNoContent, false},
+		{"unidentified", "/v1/admin/refresh", "", http.StatusUnauthorized, true},
+		{"forbidden", "/v1/admin/refresh", "Bearer other", http.StatusForbidden, false},
+		{"unprotected", "/v1/metadata", "", http.StatusNoContent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			guard.ServeHTTP(rw, r, next)
+			if rw.Code != tt.want {
+				t.Errorf("got status %d, want %d", rw.Code, tt.want)
+			}
+			if got := rw.Header().Get("WWW-Authenticate") != ""; got != tt.authenticated {
+				t.Errorf("WWW-Authenticate set = %v, want %v", got, tt.authenticated)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"context"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type peerKey struct{}
+
+// credentials are the user and primary group of the process on the other end
+// of a Unix socket.
+type credentials struct {
+	UID int
+	GID int
+}
+
+// ConnContext records the peer credentials of Unix socket connections so
+// rules can match local users. It's meant for http.Server.ConnContext.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	cred, err := peerCredentials(uc)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Unable to read Unix socket peer credentials")
+		return ctx
+	}
+
+	return context.WithValue(ctx, peerKey{}, cred)
+}
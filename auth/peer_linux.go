@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"net"
+	"syscall"
+)
+
+func peerCredentials(c *net.UnixConn) (credentials, error) {
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return credentials{}, err
+	}
+
+	var ucred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return credentials{}, err
+	}
+	if credErr != nil {
+		return credentials{}, credErr
+	}
+
+	return credentials{UID: int(ucred.Uid), GID: int(ucred.Gid)}, nil
+}
@@ -0,0 +1,14 @@
+// +build !linux
+
+package auth
+
+import (
+	"errors"
+	"net"
+)
+
+// Peer credentials are only read on Linux. Elsewhere Unix socket callers are
+// treated like TCP callers and need a token.
+func peerCredentials(c *net.UnixConn) (credentials, error) {
+	return credentials{}, errors.New("peer credentials aren't supported on this platform")
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/davepgreene/propsd-agent/config"
+)
+
+// Rules is the Authorizer built from the auth settings. The first rule whose
+// routes match a request decides it.
+type Rules struct {
+	rules []rule
+	deny  bool
+}
+
+type rule struct {
+	routes []string
+	tokens map[string]bool
+	uids   map[int]bool
+	gids   map[int]bool
+}
+
+// Load builds the tokens and rules described by c, resolving user and group
+// names.
+func Load(c config.AuthConfig) (Tokens, *Rules, error) {
+	tokens := Tokens{}
+	if c.TokenFile != "" {
+		var err error
+		if tokens, err = LoadTokens(c.TokenFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rs := &Rules{deny: c.Default == "deny"}
+	for i, r := range c.Rules {
+		compiled := rule{
+			routes: r.Routes,
+			tokens: make(map[string]bool),
+			uids:   make(map[int]bool),
+			gids:   make(map[int]bool),
+		}
+		for _, name := range r.Tokens {
+			compiled.tokens[name] = true
+		}
+		for _, name := range r.Users {
+			uid, err := lookupID(name, func(n string) (string, error) {
+				u, err := user.Lookup(n)
+				if err != nil {
+					return "", err
+				}
+				return u.Uid, nil
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("auth.rules[%d]: %v", i, err)
+			}
+			compiled.uids[uid] = true
+		}
+		for _, name := range r.Groups {
+			gid, err := lookupID(name, func(n string) (string, error) {
+				g, err := user.LookupGroup(n)
+				if err != nil {
+					return "", err
+				}
+				return g.Gid, nil
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("auth.rules[%d]: %v", i, err)
+			}
+			compiled.gids[gid] = true
+		}
+		rs.rules = append(rs.rules, compiled)
+	}
+
+	return tokens, rs, nil
+}
+
+// Authorize implements Authorizer.
+func (rs *Rules) Authorize(r *http.Request, p Principal) error {
+	for _, rule := range rs.rules {
+		if rule.matches(r.URL.Path) {
+			if rule.allows(p) {
+				return nil
+			}
+			return denied(p)
+		}
+	}
+
+	if rs.deny {
+		return denied(p)
+	}
+	return nil
+}
+
+func (r rule) matches(path string) bool {
+	for _, route := range r.routes {
+		if strings.HasSuffix(route, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(route, "*")) {
+				return true
+			}
+		} else if path == route {
+			return true
+		}
+	}
+	return false
+}
+
+func (r rule) allows(p Principal) bool {
+	if p.Token != "" && (r.tokens["*"] || r.tokens[p.Token]) {
+		return true
+	}
+	if !p.Local {
+		return false
+	}
+	if r.uids[p.UID] {
+		return true
+	}
+	for _, gid := range p.GIDs {
+		if r.gids[gid] {
+			return true
+		}
+	}
+	return false
+}
+
+// denied picks the error for a principal a rule turned away: callers that
+// didn't identify themselves at all may succeed by doing so.
+func denied(p Principal) error {
+	if p.Token == "" && !p.Local {
+		return ErrUnauthorized
+	}
+	return ErrForbidden
+}
+
+// lookupID returns the numeric ID for name, which may already be a number.
+func lookupID(name string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
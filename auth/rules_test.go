@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davepgreene/propsd-agent/config"
+)
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		route string
+		path  string
+		want  bool
+	}{
+		{"/v1/metadata", "/v1/metadata", true},
+		{"/v1/metadata", "/v1/metadata/", false},
+		{"/v1/metadata", "/v1/metadatas", false},
+		{"/v1/metadata", "/v1", false},
+		{"/v1/admin/*", "/v1/admin/refresh", true},
+		{"/v1/admin/*", "/v1/admin/", true},
+		{"/v1/admin/*", "/v1/admin", false},
+		{"/v1/admin/*", "/v1/administrator", false},
+		{"/v1/admin*", "/v1/admin", true},
+		{"/v1/admin*", "/v1/admin/refresh", true},
+		{"/v1/admin*", "/v1/administrator", true},
+		{"/v1/admin*", "/v1/adm", false},
+		{"/v1/admin*", "/v2/admin", false},
+		{"*", "/", true},
+		{"*", "/v1/anything", true},
+		{"/*", "/stats", true},
+	}
+
+	for _, tt := range tests {
+		r := rule{routes: []string{tt.route}}
+		if got := r.matches(tt.path); got != tt.want {
+			t.Errorf("route %q matching %q = %v, want %v", tt.route, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRulesAuthorize(t *testing.T) {
+	rules := []rule{
+		{
+			routes: []string{"/v1/admin/*"},
+			tokens: map[string]bool{"ops": true},
+			uids:   map[int]bool{0: true},
+			gids:   map[int]bool{},
+		},
+		{
+			routes: []string{"/v1/metadata", "/v1/properties"},
+			tokens: map[string]bool{"*": true},
+			uids:   map[int]bool{},
+			gids:   map[int]bool{100: true},
+		},
+	}
+	allow := &Rules{rules: rules}
+	deny := &Rules{rules: rules, deny: true}
+
+	anonymous := Principal{UID: -1}
+	ops := Principal{Token: "ops", UID: -1}
+	deploy := Principal{Token: "deploy", UID: -1}
+	root := Principal{Local: true, UID: 0, GIDs: []int{0}}
+	staff := Principal{Local: true, UID: 1000, GIDs: []int{1000, 100}}
+	nobody := Principal{Local: true, UID: 65534, GIDs: []int{65534}}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		path  string
+		p     Principal
+		want  error
+	}{
+		{"named token on its route", allow, "/v1/admin/refresh", ops, nil},
+		{"other token on a named token's route", allow, "/v1/admin/refresh", deploy, ErrForbidden},
+		{"anonymous on a protected route", allow, "/v1/admin/refresh", anonymous, ErrUnauthorized},
+		{"local user by uid", allow, "/v1/admin/refresh", root, nil},
+		{"local user not in the rule", allow, "/v1/admin/refresh", staff, ErrForbidden},
+		{"any token", allow, "/v1/metadata", deploy, nil},
+		{"local user by supplementary group", allow, "/v1/properties", staff, nil},
+		{"local user in no listed group", allow, "/v1/properties", nobody, ErrForbidden},
+		{"first matching rule decides", allow, "/v1/admin/refresh", staff, ErrForbidden},
+		{"unmatched route with default allow", allow, "/v1/health", anonymous, nil},
+		{"unmatched route with default deny", deny, "/v1/health", anonymous, ErrUnauthorized},
+		{"unmatched route with default deny and a token", deny, "/v1/health", ops, ErrForbidden},
+		{"unmatched route with default deny and a local user", deny, "/v1/health", root, ErrForbidden},
+		{"prefix ending in a slash doesn't cover a longer name", allow, "/v1/administrator", anonymous, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if got := tt.rules.Authorize(r, tt.p); got != tt.want {
+				t.Errorf("Authorize(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadResolvesNumericIDs(t *testing.T) {
+	_, rules, err := Load(config.AuthConfig{
+		Default: "deny",
+		Rules: []config.AuthRule{
+			{Routes: []string{"/v1/*"}, Users: []string{"1000"}, Groups: []string{"100"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/v1/metadata", nil)
+	if err := rules.Authorize(r, Principal{Local: true, UID: 1000, GIDs: []int{1000}}); err != nil {
+		t.Errorf("uid 1000: %v", err)
+	}
+	if err := rules.Authorize(r, Principal{Local: true, UID: 1001, GIDs: []int{1001, 100}}); err != nil {
+		t.Errorf("gid 100: %v", err)
+	}
+	if err := rules.Authorize(r, Principal{Local: true, UID: 1001, GIDs: []int{1001}}); err != ErrForbidden {
+		t.Errorf("uid 1001 = %v, want %v", err, ErrForbidden)
+	}
+}
+
+func TestLoadRejectsUnknownUser(t *testing.T) {
+	_, _, err := Load(config.AuthConfig{
+		Default: "allow",
+		Rules: []config.AuthRule{
+			{Routes: []string{"/v1/*"}, Users: []string{"no-such-user-propsd"}},
+		},
+	})
+	if err == nil {
+		t.Error("Load succeeded with an unknown user")
+	}
+}
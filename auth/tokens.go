@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tokens maps bearer tokens to the names rules refer to them by.
+type Tokens map[string]string
+
+// LoadTokens reads a token file. Each line holds a name and a token separated
+// by whitespace, or just a token, which is named "default". Blank lines and
+// lines starting with # are ignored.
+func LoadTokens(path string) (Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Mode().Perm()&0077 != 0 {
+		log.WithFields(log.Fields{
+			"file": path,
+			"mode": info.Mode().Perm().String(),
+		}).Warn("Token file is readable by other users")
+	}
+
+	tokens := make(Tokens)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1:
+			tokens[fields[0]] = "default"
+		case 2:
+			tokens[fields[1]] = fields[0]
+		default:
+			return nil, fmt.Errorf("%s:%d: expected a name and a token", path, n)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Lookup returns the name of token if it's valid. Every token is compared so
+// the time taken doesn't reveal how close a guess was.
+func (t Tokens) Lookup(token string) (string, bool) {
+	var name string
+	found := false
+	for candidate, n := range t {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			name, found = n, true
+		}
+	}
+	return name, found
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+)
+
+// StatusError is returned when the agent responds with a non-2xx status.
+type StatusError struct {
+	Path string
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("agent returned %d %s for %s", e.Code, http.StatusText(e.Code), e.Path)
+}
+
+// Client talks to a running agent's HTTP API.
+type Client struct {
+	url    string
+	token  string
+	client http.Client
+}
+
+// New returns a client for the agent listening at url. A unix:// URL connects
+// to the agent's Unix socket instead of a TCP address.
+func New(url string) *Client {
+	c := &Client{
+		url: strings.TrimSuffix(url, "/"),
+		client: http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+
+	if strings.HasPrefix(url, "unix://") {
+		socket := strings.TrimPrefix(url, "unix://")
+		c.url = "http://unix"
+		c.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	return c
+}
+
+// SetToken sets the bearer token sent with every request.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Properties returns the raw JSON properties document.
+func (c *Client) Properties() ([]byte, error) {
+	return c.Get("/v1/properties")
+}
+
+// Metadata returns the instance metadata the agent has collected.
+func (c *Client) Metadata() (*parsers.MetadataProperties, error) {
+	b, err := c.Get("/v1/metadata")
+	if err != nil {
+		return nil, err
+	}
+
+	var m parsers.MetadataProperties
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Get requests path from the agent and returns the response body.
+func (c *Client) Get(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, &StatusError{Path: path, Code: resp.StatusCode}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/davepgreene/propsd-agent/client"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/serializers"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes for the client commands. They follow grep and diff: 1 means the
+// answer was "no" (missing key, unhealthy agent, documents differ) and 2
+// means the question couldn't be answered.
+const (
+	exitNegative = 1
+	exitError    = 2
+)
+
+var dumpFormat string
+
+var getCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print a single property from a running agent",
+	Long: `Print the value of a property from a running agent. Keys use the
+	flattened form, for example database.host. Exits with 1 if the key
+	doesn't exist.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exit(exitError, fmt.Errorf("get takes exactly one key"))
+		}
+
+		flattened, err := agentProperties(newClient())
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		value, ok := flattened[args[0]]
+		if !ok {
+			exit(exitNegative, fmt.Errorf("%s is not set", args[0]))
+		}
+
+		fmt.Println(value)
+	},
+}
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print every property from a running agent",
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "/v1/properties"
+		if dumpFormat != "" {
+			if _, err := serializers.ParseFormat(dumpFormat); err != nil {
+				exit(exitError, err)
+			}
+			path += "?format=" + url.QueryEscape(dumpFormat)
+		}
+
+		b, err := newClient().Get(path)
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		os.Stdout.Write(b)
+	},
+}
+
+var metadataCmd = &cobra.Command{
+	Use:   "metadata",
+	Short: "Print the instance metadata collected by a running agent",
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := newClient().Get("/v1/metadata")
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		printJSON(b)
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the status of a running agent",
+	Long: `Print the status document of a running agent. Exits with 1 if the
+	agent reports itself unhealthy and 2 if it can't be reached or refuses
+	the request.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := newClient().Get("/v1/status")
+		if serr, ok := err.(*client.StatusError); ok && unhealthy(serr.Code, b) {
+			printJSON(b)
+			os.Exit(exitNegative)
+		}
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		printJSON(b)
+	},
+}
+
+// unhealthy reports whether an error response to a status request is the agent
+// saying it's unhealthy, rather than something like an authorization failure.
+func unhealthy(code int, body []byte) bool {
+	if code == http.StatusServiceUnavailable {
+		return true
+	}
+	if code < 500 {
+		return false
+	}
+
+	var status struct {
+		Code int `json:"code"`
+	}
+	return json.Unmarshal(body, &status) == nil && status.Code == code
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <file>",
+	Short: "Compare a saved properties document with a running agent",
+	Long: `Compare a JSON properties document, such as the output of dump,
+	with the properties currently served by a running agent. Use - to read
+	the document from stdin. Keys only in the file are prefixed with -,
+	keys only on the agent with + and changed keys with ~. Exits with 1 if
+	the documents differ.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exit(exitError, fmt.Errorf("diff takes exactly one file"))
+		}
+
+		var b []byte
+		var err error
+		if args[0] == "-" {
+			b, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			b, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		saved, err := serializers.Decode(b)
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		current, err := agentProperties(newClient())
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		previous := serializers.Flatten(saved, lookupOptions())
+		different := false
+		for _, k := range serializers.Keys(previous) {
+			value, ok := current[k]
+			switch {
+			case !ok:
+				fmt.Printf("- %s=%s\n", k, previous[k])
+			case value != previous[k]:
+				fmt.Printf("~ %s=%s -> %s\n", k, previous[k], value)
+			default:
+				continue
+			}
+			different = true
+		}
+		for _, k := range serializers.Keys(current) {
+			if _, ok := previous[k]; !ok {
+				fmt.Printf("+ %s=%s\n", k, current[k])
+				different = true
+			}
+		}
+
+		if different {
+			os.Exit(exitNegative)
+		}
+	},
+}
+
+func newClient() *client.Client {
+	err := initializeConfig()
+	initializeLog()
+	if err != nil {
+		exit(exitError, err)
+	}
+
+	c, err := agentClient()
+	if err != nil {
+		exit(exitError, err)
+	}
+
+	return c
+}
+
+// lookupOptions flattens documents the same way as the conqueso endpoint but
+// keeps every top-level key so any property can be looked up.
+func lookupOptions() serializers.FlattenOptions {
+	o := config.SerializerOptions().Flatten
+	o.Include = nil
+	o.Exclude = nil
+
+	return o
+}
+
+func agentProperties(c *client.Client) (map[string]string, error) {
+	body, err := c.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	properties, err := serializers.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return serializers.Flatten(properties, lookupOptions()), nil
+}
+
+func printJSON(b []byte) {
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		os.Stdout.Write(b)
+		return
+	}
+
+	out.WriteByte('\n')
+	out.WriteTo(os.Stdout)
+}
+
+func exit(code int, err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(code)
+}
+
+func init() {
+	dumpCmd.Flags().StringVarP(&dumpFormat, "format", "f", "", "output format: json, flat, properties, yaml, toml, hcl, dotenv or shell")
+
+	PropsdCmd.AddCommand(getCmd, dumpCmd, metadataCmd, statusCmd, diffCmd)
+}
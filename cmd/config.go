@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the agent configuration",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the configuration and print the effective settings",
+	Long: `Validate the configuration file and environment and print the
+	effective merged settings with secrets redacted. Exits with 1 if the
+	configuration is invalid.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := initializeConfig(); err != nil {
+			exit(exitNegative, err)
+		}
+
+		_, unused, err := config.Load()
+		for _, key := range unused {
+			fmt.Fprintf(os.Stderr, "warning: unknown setting %s\n", key)
+		}
+
+		b, _ := json.MarshalIndent(config.Redacted(), "", "  ")
+		fmt.Println(string(b))
+
+		if err != nil {
+			exit(exitNegative, err)
+		}
+
+		fmt.Fprintln(os.Stderr, "Configuration is valid")
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configCheckCmd)
+	PropsdCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/secrets"
+	"github.com/spf13/cobra"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt a property value",
+	Long: `Encrypt the value read from standard input with the configured
+	secrets provider and print it as an encrypted property value, ready to be
+	used in a properties document. The value is read from standard input so it
+	doesn't end up in shell history or the process list. A single trailing
+	newline is dropped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := initializeConfig()
+		initializeLog()
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		d, err := config.Decrypter()
+		if err != nil {
+			exit(exitError, err)
+		}
+		if d == nil {
+			exit(exitError, errors.New("secrets.provider isn't configured"))
+		}
+		e, ok := d.(secrets.Encrypter)
+		if !ok {
+			exit(exitError, errors.New("the configured secrets provider can't encrypt values"))
+		}
+
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		ciphertext, err := e.Encrypt(strings.TrimSuffix(string(b), "\n"))
+		if err != nil {
+			exit(exitError, err)
+		}
+
+		out, _ := json.Marshal(map[string]string{secrets.Marker: ciphertext})
+		fmt.Println(string(out))
+	},
+}
+
+func init() {
+	PropsdCmd.AddCommand(encryptCmd)
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/client"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/secrets"
+	"github.com/davepgreene/propsd-agent/serializers"
+	"github.com/davepgreene/propsd-agent/supervisor"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var execPrefix string
+var execOnChange string
+var execSignal string
+var execInterval time.Duration
+
+var signals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Run a command with properties as environment variables",
+	Long: `Run a command with the flattened properties from a running agent
+	exported as environment variables. Names are built from the env
+	settings. Signals received by propsd are forwarded to the command and
+	propsd exits with the command's exit code. With --on-change the agent
+	is polled and the command is restarted or signaled when the properties
+	change.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := initializeConfig()
+		initializeLog()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return fmt.Errorf("a command is required")
+		}
+
+		sig, ok := signals[strings.ToUpper(execSignal)]
+		if !ok {
+			return fmt.Errorf("unsupported signal %q", execSignal)
+		}
+
+		if execOnChange != "none" && execOnChange != "restart" && execOnChange != "signal" {
+			return fmt.Errorf("--on-change must be one of none, restart or signal")
+		}
+
+		o := config.SerializerOptions()
+		if cmd.Flags().Changed("prefix") {
+			o.Env.Prefix = execPrefix
+		}
+
+		c, err := agentClient()
+		if err != nil {
+			return err
+		}
+		d, err := config.Decrypter()
+		if err != nil {
+			return err
+		}
+		env, err := execEnvironment(c, o, d)
+		if err != nil {
+			return err
+		}
+
+		// Forward the signals a supervisor is expected to pass on. SIGINT
+		// is always caught so propsd outlives the child and can report its
+		// exit code, but on a terminal the child already got it from the
+		// process group, so it's only forwarded when there's no terminal.
+		interactive := terminal.IsTerminal(int(os.Stdin.Fd()))
+		sigc := make(chan os.Signal, 16)
+		signal.Notify(sigc, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGINT)
+
+		child := supervisor.New(args)
+		if err := child.Start(env); err != nil {
+			return err
+		}
+
+		var poll <-chan time.Time
+		if execOnChange != "none" {
+			t := time.NewTicker(execInterval)
+			defer t.Stop()
+			poll = t.C
+		}
+
+		for {
+			select {
+			case s := <-sigc:
+				if s == syscall.SIGINT && interactive {
+					continue
+				}
+				child.Signal(s)
+			case err := <-child.Exited():
+				os.Exit(supervisor.ExitCode(err))
+			case <-poll:
+				updated, err := execEnvironment(c, o, d)
+				if err != nil {
+					log.Error(err)
+					continue
+				}
+				if reflect.DeepEqual(env, updated) {
+					continue
+				}
+				env = updated
+
+				// Returning here would leave the child running with no
+				// one to reap it or pass on its exit code, so failures
+				// are logged and the loop carries on.
+				if execOnChange == "restart" {
+					if err := child.Restart(env); err != nil {
+						log.WithField("error", err).Error("Unable to restart the child process")
+						child.Signal(syscall.SIGKILL)
+						os.Exit(supervisor.ExitCode(<-child.Exited()))
+					}
+					continue
+				}
+				if err := child.Signal(sig); err != nil {
+					log.WithField("error", err).Error("Unable to signal the child process")
+				}
+			}
+		}
+	},
+}
+
+// execEnvironment returns the agent's environment with the flattened
+// properties appended so they take precedence over inherited variables.
+func execEnvironment(c *client.Client, o serializers.Options, d secrets.Decrypter) ([]string, error) {
+	body, err := c.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := serializers.Decode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// The child's environment is where encrypted values get rendered.
+	properties, err := secrets.Decrypt(decoded, d)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := serializers.EnvVars(serializers.Flatten(properties, o.Flatten), o.Env)
+
+	return append(os.Environ(), vars...), nil
+}
+
+func init() {
+	execCmd.Flags().StringVar(&execPrefix, "prefix", "", "prefix for variable names (defaults to env.prefix)")
+	execCmd.Flags().StringVar(&execOnChange, "on-change", "none", "what to do when properties change: none, restart or signal")
+	execCmd.Flags().StringVar(&execSignal, "signal", "SIGHUP", "signal sent with --on-change=signal")
+	execCmd.Flags().DurationVar(&execInterval, "interval", 30*time.Second, "how often to poll the agent for changes")
+
+	PropsdCmd.AddCommand(execCmd)
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/client"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/render"
+	"github.com/davepgreene/propsd-agent/serializers"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var renderTemplates []string
+var renderCommand string
+var renderWatch bool
+var renderInterval time.Duration
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render templates with properties from a running agent",
+	Long: `Render Go text/template files with the properties document and
+	instance metadata served by a running agent. Templates are given as
+	source:destination[:mode] and each destination is replaced atomically.
+	The properties are available as .Properties and the metadata as
+	.Metadata. A missing key is an error, so give optional keys a fallback
+	with index, as in {{ index .Properties "port" | default "8080" }}.
+	With --watch the agent is polled and templates are re-rendered
+	whenever the properties change.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := initializeConfig()
+		initializeLog()
+		if err != nil {
+			return err
+		}
+
+		r := &render.Renderer{Command: renderCommand}
+		for _, t := range renderTemplates {
+			tmpl, err := render.ParseTemplate(t)
+			if err != nil {
+				return err
+			}
+			r.Templates = append(r.Templates, tmpl)
+		}
+
+		if len(r.Templates) == 0 {
+			return fmt.Errorf("at least one --template is required")
+		}
+
+		c, err := agentClient()
+		if err != nil {
+			return err
+		}
+		if r.Decrypter, err = config.Decrypter(); err != nil {
+			return err
+		}
+
+		if !renderWatch {
+			return renderOnce(c, r)
+		}
+
+		if err := renderOnce(c, r); err != nil {
+			log.Error(err)
+		}
+
+		t := time.NewTicker(renderInterval)
+		defer t.Stop()
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+		for {
+			select {
+			case <-t.C:
+				if err := renderOnce(c, r); err != nil {
+					log.Error(err)
+				}
+			case <-sig:
+				return nil
+			}
+		}
+	},
+}
+
+func renderOnce(c *client.Client, r *render.Renderer) error {
+	body, err := c.Properties()
+	if err != nil {
+		return err
+	}
+
+	properties, err := serializers.Decode(body)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := c.Metadata()
+	if err != nil {
+		return err
+	}
+
+	changed, err := r.Render(render.Data{
+		Properties: properties,
+		Metadata:   metadata,
+	})
+
+	// Files written before a template failed still need the reload. They'll
+	// be unchanged on the next pass, so it wouldn't happen then.
+	if changed {
+		if reloadErr := r.Reload(); reloadErr != nil {
+			if err == nil {
+				return reloadErr
+			}
+			log.WithFields(log.Fields{
+				"error": reloadErr,
+			}).Error("Unable to run reload command")
+		}
+	}
+
+	return err
+}
+
+func init() {
+	renderCmd.Flags().StringArrayVarP(&renderTemplates, "template", "t", nil, "template to render as source:destination[:mode] (repeatable)")
+	renderCmd.Flags().StringVar(&renderCommand, "exec", "", "command to run when any rendered file changes")
+	renderCmd.Flags().BoolVarP(&renderWatch, "watch", "w", false, "keep running and re-render when properties change")
+	renderCmd.Flags().DurationVar(&renderInterval, "interval", 30*time.Second, "how often to poll the agent in watch mode")
+
+	PropsdCmd.AddCommand(renderCmd)
+}
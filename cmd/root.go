@@ -1,21 +1,31 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 	log "github.com/sirupsen/logrus"
+	"github.com/davepgreene/propsd-agent/client"
 	"github.com/davepgreene/propsd-agent/http"
+	"github.com/davepgreene/propsd-agent/hooks"
+	"github.com/davepgreene/propsd-agent/parsers"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/davepgreene/propsd-agent/config"
 	"github.com/davepgreene/propsd-agent/sources"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/davepgreene/propsd-agent/events"
+	"github.com/davepgreene/propsd-agent/scheduler"
 	"github.com/davepgreene/propsd-agent/utils"
 )
 
 var cfgFile string
 var verbose bool
+var agentURL string
+var tokenFile string
 
 var PropsdCmd = &cobra.Command{
 	Use:   "propsd",
@@ -34,18 +44,220 @@ var PropsdCmd = &cobra.Command{
 			panic(err)
 		}
 
-		s, err := session.NewSession()
-		if err == nil {
-			m := sources.NewMetadataSource(*s)
-			m.Get()
-			m.Tags()
-			utils.Schedule(m.Get, time.Millisecond * viper.GetDuration("metadata.interval"))
-			utils.Schedule(m.Tags, time.Millisecond * viper.GetDuration("tags.interval"))
-			http.Handler(m)
+		_, unused, err := config.Load()
+		for _, key := range unused {
+			log.Warnf("Unknown setting %s", key)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		utils.SetAPIRateLimit(viper.GetFloat64("throttle.rate"), viper.GetInt("throttle.burst"))
+		config.OnReload(func(c *config.Config) {
+			utils.SetAPIRateLimit(c.Throttle.Rate, c.Throttle.Burst)
+		})
+
+		config.OnReload(func(c *config.Config) {
+			if verbose {
+				return
+			}
+			if lvl, err := log.ParseLevel(c.Log.Level); err == nil {
+				log.SetLevel(lvl)
+			}
+		})
+		if err := config.Watch(); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("Unable to watch config file for changes")
+		}
+
+		jitter := viper.GetFloat64("scheduler.jitter")
+
+		// Hooks are subscribed before any source starts so they see every
+		// event.
+		hooks.Start()
+
+		env := sources.DetectEnvironment(config.Current())
+		log.WithFields(log.Fields{
+			"provider":   env.Provider,
+			"ecs":        env.ECS != "",
+			"kubernetes": env.Kubernetes != "",
+		}).Info("Detected runtime environment")
+
+		var m sources.MetadataProvider
+		if env.Provider == parsers.ProviderNone {
+			m = sources.NoMetadata()
+			sources.Disable("metadata", "no instance metadata service was found")
+
+			// A metadata service that didn't answer the probes may only be
+			// slow to come up, so it's looked for again in the background.
+			if env.Probed {
+				s := sources.NewSwitchableProvider(m)
+				m = s
+				go sources.AwaitMetadataProvider(scheduler.Context(), func() config.MetadataConfig {
+					return config.Current().Metadata
+				}, func(provider string) {
+					p, err := startProvider(provider, jitter)
+					if err != nil {
+						log.WithFields(log.Fields{
+							"error":    err,
+							"provider": provider,
+						}).Error("Unable to start reading instance metadata")
+						return
+					}
+					s.Set(p)
+				})
+			}
+		} else {
+			m, err = startProvider(env.Provider, jitter)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		// The instance profile, EC2 tags, auto scaling group and instance
+		// notices only exist on AWS.
+		if env.Provider != parsers.ProviderAWS {
+			for _, name := range []string{"credentials", "tags", "asg", "notices"} {
+				sources.Disable(name, "not running on EC2")
+			}
 		}
+
+		// Sources that only apply to some environments add their own
+		// section to the upstream document when they're available.
+		var sections []sources.Section
+		if env.ECS != "" {
+			e := sources.NewECSSource(env.ECS)
+			ecs := scheduler.New("ecs", e.Get, func() time.Duration {
+				return config.Current().ECS.Interval
+			}, jitter)
+			ecs.RunNow()
+			ecs.Start(context.Background())
+			sections = append(sections, e)
+		} else {
+			sources.Disable("ecs", "not running in an ECS task")
+		}
+		if env.Kubernetes != "" {
+			if k, err := sources.NewKubernetesSource(env.Kubernetes, viper.GetString("kubernetes.path")); err != nil {
+				log.WithFields(log.Fields{
+					"error":  err,
+					"source": env.Kubernetes,
+				}).Error("Unable to read Kubernetes pod metadata")
+			} else {
+				kubernetes := scheduler.New("kubernetes", k.Get, func() time.Duration {
+					return config.Current().Kubernetes.Interval
+				}, jitter)
+				kubernetes.RunNow()
+				kubernetes.Start(context.Background())
+				sections = append(sections, k)
+			}
+		} else {
+			sources.Disable("kubernetes", "not running in a Kubernetes pod")
+		}
+
+		http.Handler(m, sections...)
 	},
 }
 
+// startProvider starts reading instance metadata from the named provider's
+// metadata service.
+func startProvider(provider string, jitter float64) (sources.MetadataProvider, error) {
+	c := config.Current().Metadata
+
+	switch provider {
+	case parsers.ProviderAWS:
+		s, err := session.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		return startAWSMetadata(sources.NewMetadataSource(*s), jitter), nil
+	case parsers.ProviderGCE:
+		return startMetadata(sources.NewGCEProvider(c.GCE.Host, c.Timeout), jitter), nil
+	case parsers.ProviderAzure:
+		return startMetadata(sources.NewAzureProvider(c.Azure.Host, c.Azure.Version, c.Timeout), jitter), nil
+	}
+
+	return nil, fmt.Errorf("unknown metadata provider %q", provider)
+}
+
+// startMetadata schedules the refreshes of a provider that reads everything
+// from its metadata service.
+func startMetadata(m sources.MetadataProvider, jitter float64) sources.MetadataProvider {
+	metadata := scheduler.New("metadata", m.Get, func() time.Duration {
+		return config.Current().Metadata.Interval
+	}, jitter)
+	metadata.RunNow()
+	metadata.Start(context.Background())
+
+	return m
+}
+
+// startAWSMetadata schedules the refreshes of the EC2 instance metadata and
+// the AWS APIs that build on it.
+func startAWSMetadata(m *sources.Metadata, jitter float64) *sources.Metadata {
+	metadata := scheduler.New("metadata", m.Get, func() time.Duration {
+		return config.Current().Metadata.Interval
+	}, jitter)
+	asg := scheduler.New("asg", m.AutoScaling, func() time.Duration {
+		c := config.Current()
+		return m.AutoScalingInterval(c.ASG.Interval, c.Throttle.MaxBackoff)
+	}, jitter)
+	tags := scheduler.New("tags", m.Tags, func() time.Duration {
+		c := config.Current()
+		return m.TagsInterval(c.Tags.Interval, c.Throttle.MaxBackoff)
+	}, jitter)
+	// Credentials are refreshed ahead of their expiry rather than on a
+	// fixed interval, so they're not jittered.
+	credentials := scheduler.New("credentials", m.Credentials, func() time.Duration {
+		c := config.Current()
+		return m.CredentialsRefresh(c.Credentials.Margin, c.Metadata.Interval)
+	}, 0)
+	// A spot interruption only gives two minutes' notice, so notices are
+	// checked on a short interval that isn't jittered either.
+	notices := scheduler.New("notices", m.Notices, func() time.Duration {
+		return config.Current().Notices.Interval
+	}, 0)
+
+	// We can use goroutines for all the other metadata but because ASG and tags rely on
+	// instance region and ID we have to wait until those are complete.
+	// The group is cached between lookups, so it's described again as soon
+	// as a notice says the instance's place in it is changing.
+	events.Subscribe(func(e events.Event) {
+		switch e.Type {
+		case "target-lifecycle-state", "spot-interruption":
+			asg.RunNow()
+		}
+	})
+
+	metadata.RunNow()
+	metadata.Start(context.Background())
+	credentials.RunNow()
+	credentials.Start(context.Background())
+	notices.RunNow()
+	notices.Start(context.Background())
+
+	// Tags and the ASG come from rate limited AWS APIs, so their first
+	// lookups are spread out in case a whole fleet starts at once. The group
+	// is usually named in the tags, so they're read first. Shutting down
+	// during the splay means they're never started.
+	go func() {
+		ctx := scheduler.Context()
+		t := time.NewTimer(scheduler.Splay(config.Current().Throttle.Splay))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		tags.RunNow()
+		asg.RunNow()
+		tags.Start(ctx)
+		asg.Start(ctx)
+	}()
+
+	return m
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the PropsdCmd.
 func Execute() {
@@ -58,10 +270,56 @@ func Execute() {
 func init() {
 	PropsdCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file")
 	PropsdCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose level logging")
+	PropsdCmd.PersistentFlags().StringVar(&agentURL, "agent", "", "agent URL for client commands, http:// or unix:// (defaults to the service settings)")
+	PropsdCmd.PersistentFlags().StringVar(&tokenFile, "token-file", "", "file holding the bearer token client commands send (defaults to $PROPSD_TOKEN)")
 	validConfigFilenames := []string{"json"}
 	PropsdCmd.PersistentFlags().SetAnnotation("config", cobra.BashCompFilenameExt, validConfigFilenames)
 }
 
+// agentAddress returns the URL of the local agent, preferring --agent, then
+// the agent's Unix socket and finally its TCP address.
+func agentAddress() string {
+	if agentURL != "" {
+		return agentURL
+	}
+
+	if socket := viper.GetString("service.socket"); socket != "" {
+		return "unix://" + socket
+	}
+
+	return fmt.Sprintf("http://%s:%d", viper.GetString("service.host"), viper.GetInt("service.port"))
+}
+
+// agentClient returns a client for the local agent that authenticates with
+// the token from --token-file or $PROPSD_TOKEN, if either is set. A token file
+// in the agent's "name token" format can be used as is; the first token is
+// sent.
+func agentClient() (*client.Client, error) {
+	c := client.New(agentAddress())
+
+	token := os.Getenv("PROPSD_TOKEN")
+	if tokenFile != "" {
+		b, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = ""
+		for _, line := range strings.Split(string(b), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+				token = fields[len(fields)-1]
+				break
+			}
+		}
+		if token == "" {
+			return nil, fmt.Errorf("%s doesn't contain a token", tokenFile)
+		}
+	}
+	c.SetToken(token)
+
+	return c, nil
+}
+
 func initializeLog() {
 	log.RegisterExitHandler(func() {
 		log.Info("Shutting down")
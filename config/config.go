@@ -8,33 +8,181 @@ import (
 var service = map[string]interface{} {
 	"host": 	"127.0.0.1",
 	"port":		9100,
+	"socket":	"",
+	"tls": map[string]interface{}{
+		"cert":	"",
+		"key":	"",
+	},
 }
 
 var log = map[string]interface{}{
-	"level": 	logrus.InfoLevel,
+	"level": 	logrus.InfoLevel.String(),
 	"json":     	true,
 	"requests": 	true,
 }
 
+// metadata.provider picks the metadata service to read: "aws", "gce",
+// "azure" or "none" to read none at all. Left empty it's worked out from the
+// machine the agent runs on.
+// metadata.host is the EC2 instance metadata service; the others have their
+// own.
+//
+// metadata.fields picks which instance metadata fields are served at
+// /v1/metadata and which are sent upstream. Credentials stay on the instance
+// unless they're asked for.
 var metadata = map[string]interface{}{
 	"host": 	"http://169.254.169.254",
-	"interval": 	30000,
+	"interval": 	"30s",
 	"version":	"latest",
+	"provider":	"",
+	"gce":		map[string]interface{}{
+		"host":	"http://metadata.google.internal",
+	},
+	"azure":	map[string]interface{}{
+		"host":		"http://169.254.169.254",
+		"version":	"2021-02-01",
+	},
+	"fields":	map[string]interface{}{
+		"endpoint":	map[string]interface{}{
+			"include":	[]string{},
+			"exclude":	[]string{},
+		},
+		"upstream":	map[string]interface{}{
+			"include":	[]string{},
+			"exclude":	[]string{"credentials"},
+		},
+	},
 }
 
 var tags = map[string]interface{}{
-	"interval":	300000,
+	"interval":	"5m",
+}
+
+// asg.interval is how often the instance's auto scaling group is looked up.
+// An instance rarely changes groups, and a lifecycle notice or spot
+// interruption triggers a lookup straight away, so it's looked up far less
+// often than the rest of the metadata. asg.events publishes an event whenever
+// the instance's lifecycle state in the group changes.
+var asg = map[string]interface{}{
+	"interval":	"1h",
+	"events":	false,
+}
+
+// notices.interval is how often instance metadata is checked for a spot
+// interruption, scheduled maintenance or a lifecycle state change. A spot
+// instance only gets two minutes' notice, so it's checked far more often than
+// the rest of the metadata.
+var notices = map[string]interface{}{
+	"interval":	"5s",
+}
+
+// hooks.handlers are run when an event is published. Each handler either
+// POSTs the event to url or runs command with the event on stdin, and is
+// limited to the listed events, or gets every event when none are listed.
+// hooks.timeout is how long a handler may take before it's abandoned.
+var hookDefaults = map[string]interface{}{
+	"timeout":	"30s",
+	"handlers":	[]interface{}{},
+}
+
+// ecs.uri overrides the task metadata endpoint the ECS agent advertises in
+// ECS_CONTAINER_METADATA_URI_V4. Outside of ECS neither is set and the task
+// metadata isn't read.
+var ecs = map[string]interface{}{
+	"uri":		"",
+	"interval":	"1m",
+}
+
+// kubernetes.source picks where pod metadata is read from: "downward" reads
+// the files the downward API writes to kubernetes.path and "api" asks the
+// Kubernetes API with the pod's service account. Left empty the downward API
+// is used when kubernetes.path exists and the API when running in a cluster.
+var kubernetes = map[string]interface{}{
+	"source":	"",
+	"path":		"/etc/podinfo",
+	"interval":	"1m",
+}
+
+// credentials.margin is how long before the instance profile credentials
+// expire that they're refreshed.
+var credentials = map[string]interface{}{
+	"margin":	"5m",
 }
 
 var propsd = map[string]interface{}{
 	"upstream": "http://localhost:9301/upstream",
+	"interval": "30s",
+}
+
+// auth controls who may call the local API. Rules are checked in order and the
+// first one whose routes match a request decides it; requests no rule matches
+// fall back to auth.default.
+var auth = map[string]interface{}{
+	"token_file":	"",
+	"default":	"allow",
+	"rules":	[]interface{}{},
+}
+
+// secrets.provider picks how encrypted property values are decrypted when
+// they're rendered. Leaving it empty means they can't be.
+var secrets = map[string]interface{}{
+	"provider":	"",
+	"local":	map[string]interface{}{
+		"key_file":	"",
+	},
+}
+
+// throttle limits how fast the agent calls AWS APIs, shared across every job
+// and refresh. throttle.splay spreads out the first calls of agents started
+// together and throttle.max_backoff caps how far a job's interval is
+// stretched while AWS is throttling it.
+var throttle = map[string]interface{}{
+	"rate":		1.0,
+	"burst":	5,
+	"splay":	"15s",
+	"max_backoff":	"1h",
+}
+
+var scheduler = map[string]interface{}{
+	"jitter":	0.1,
+}
+
+var conqueso = map[string]interface{}{
+	"separator":	".",
+	"arrays":	"join",
+	"join":		",",
+	"include":	[]string{},
+	"exclude":	[]string{"instance", "tags"},
+	"encoding":	"utf8",
+}
+
+var env = map[string]interface{}{
+	"prefix":	"",
+	"case":		"upper",
+	"replacement":	"_",
 }
 
 // Defaults generates a set of default configuration options
 func Defaults() {
-	viper.SetDefault("service", service)
-	viper.SetDefault("propsd", propsd)
-	viper.SetDefault("log", log)
-	viper.SetDefault("metadata", metadata)
-	viper.SetDefault("tags", tags)
+	setDefaults(viper.GetViper())
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("service", service)
+	v.SetDefault("propsd", propsd)
+	v.SetDefault("log", log)
+	v.SetDefault("metadata", metadata)
+	v.SetDefault("tags", tags)
+	v.SetDefault("asg", asg)
+	v.SetDefault("notices", notices)
+	v.SetDefault("hooks", hookDefaults)
+	v.SetDefault("ecs", ecs)
+	v.SetDefault("kubernetes", kubernetes)
+	v.SetDefault("credentials", credentials)
+	v.SetDefault("conqueso", conqueso)
+	v.SetDefault("env", env)
+	v.SetDefault("scheduler", scheduler)
+	v.SetDefault("throttle", throttle)
+	v.SetDefault("auth", auth)
+	v.SetDefault("secrets", secrets)
 }
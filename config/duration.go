@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ParseDuration converts a duration setting into a time.Duration. Strings are
+// parsed as Go durations such as "30s" or "5m". Numbers, and strings that only
+// hold a number, are taken as milliseconds for compatibility with older
+// config files.
+func ParseDuration(v interface{}) (time.Duration, error) {
+	switch t := v.(type) {
+	case nil:
+		return 0, nil
+	case time.Duration:
+		return t, nil
+	case string:
+		s := strings.TrimSpace(t)
+		if s == "" {
+			return 0, nil
+		}
+		if ms, err := strconv.ParseFloat(s, 64); err == nil {
+			return milliseconds(ms), nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a duration (use a value like \"30s\" or a number of milliseconds)", t)
+		}
+		return d, nil
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return milliseconds(float64(value.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return milliseconds(float64(value.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return milliseconds(value.Float()), nil
+	}
+
+	return 0, fmt.Errorf("%v is not a duration", v)
+}
+
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// GetDuration reads a duration setting as it was at startup. Invalid values
+// are reported by Load, so they're treated as zero here. Settings that can
+// change on reload should be read from Current instead.
+//
+// NOTE: This should only be called after viper initializes
+func GetDuration(key string) time.Duration {
+	d, _ := ParseDuration(viper.Get(key))
+	return d
+}
+
+// durationHook decodes duration settings with ParseDuration.
+func durationHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(time.Duration(0)) {
+		return data, nil
+	}
+
+	return ParseDuration(data)
+}
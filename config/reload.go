@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const watchDebounce = 500 * time.Millisecond
+
+var (
+	reloadMutex sync.Mutex
+	current     *Config
+	hooks       []func(*Config)
+
+	// applyMutex serialises reloads, including their hooks, so hooks see
+	// configurations in the order they were loaded. It's held without
+	// reloadMutex so hooks can call Current.
+	applyMutex sync.Mutex
+)
+
+// restartSettings are read once at startup, so changing them only takes
+// effect after a restart. For service.tls that's switching TLS on or off; the
+// certificate and key files are reloaded by the server.
+var restartSettings = map[string]func(*Config) interface{}{
+	"service.host":           func(c *Config) interface{} { return c.Service.Host },
+	"service.port":           func(c *Config) interface{} { return c.Service.Port },
+	"service.socket":         func(c *Config) interface{} { return c.Service.Socket },
+	"service.tls":            func(c *Config) interface{} { return c.Service.TLS.Cert != "" },
+	"log.json":               func(c *Config) interface{} { return c.Log.JSON },
+	"log.requests":           func(c *Config) interface{} { return c.Log.Requests },
+	"metadata.host":          func(c *Config) interface{} { return c.Metadata.Host },
+	"metadata.version":       func(c *Config) interface{} { return c.Metadata.Version },
+	"metadata.timeout":       func(c *Config) interface{} { return c.Metadata.Timeout },
+	"scheduler.jitter":       func(c *Config) interface{} { return c.Scheduler.Jitter },
+	"secrets.provider":       func(c *Config) interface{} { return c.Secrets.Provider },
+	"secrets.local.key_file": func(c *Config) interface{} { return c.Secrets.Local.KeyFile },
+	"ecs.uri":                func(c *Config) interface{} { return c.ECS.URI },
+	"kubernetes.source":      func(c *Config) interface{} { return c.Kubernetes.Source },
+	"kubernetes.path":        func(c *Config) interface{} { return c.Kubernetes.Path },
+	"metadata.gce.host":      func(c *Config) interface{} { return c.Metadata.GCE.Host },
+	"metadata.azure.host":    func(c *Config) interface{} { return c.Metadata.Azure.Host },
+	"metadata.azure.version": func(c *Config) interface{} { return c.Metadata.Azure.Version },
+	"metadata.provider":      func(c *Config) interface{} { return c.Metadata.Provider },
+	"throttle.splay":         func(c *Config) interface{} { return c.Throttle.Splay },
+}
+
+// Current returns the configuration from the last successful Load or Reload.
+func Current() *Config {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	return current
+}
+
+func setCurrent(c *Config) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	current = c
+}
+
+// OnReload registers fn to be called with the new configuration after each
+// successful reload. Hooks run once the new configuration is current, so they
+// may call Current.
+func OnReload(fn func(*Config)) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	hooks = append(hooks, fn)
+}
+
+// Reload re-reads the config file and applies it if it's valid. An invalid
+// file is rejected and the running configuration is left untouched. It
+// returns the changed settings that need a restart to take effect.
+//
+// NOTE: This should only be called after viper initializes
+func Reload() ([]string, error) {
+	applyMutex.Lock()
+	defer applyMutex.Unlock()
+
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil, fmt.Errorf("no config file to reload")
+	}
+
+	// The new file is read into its own viper rather than the global one,
+	// which is left as it was at startup because viper isn't safe to change
+	// while it's being read. Settings that can change on reload are read from
+	// Current instead.
+	v := viper.New()
+	setDefaults(v)
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	v.AutomaticEnv()
+
+	c, _, err := load(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hooks are copied and called without the lock, as a slow hook
+	// would otherwise hold up every caller of Current.
+	reloadMutex.Lock()
+	previous := current
+	current = c
+	fns := append([]func(*Config){}, hooks...)
+	reloadMutex.Unlock()
+
+	var restart []string
+	if previous != nil {
+		for key, setting := range restartSettings {
+			if !reflect.DeepEqual(setting(previous), setting(c)) {
+				restart = append(restart, key)
+			}
+		}
+	}
+	sort.Strings(restart)
+
+	for _, fn := range fns {
+		fn(c)
+	}
+
+	return restart, nil
+}
+
+// ReloadAndLog reloads the configuration and logs the outcome.
+func ReloadAndLog() {
+	restart, err := Reload()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("Unable to reload config. Keeping the current settings.")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"file": viper.ConfigFileUsed(),
+	}).Info("Reloaded config file")
+
+	for _, key := range restart {
+		logrus.Warnf("Setting %s changed but only takes effect after a restart", key)
+	}
+}
+
+// Watch reloads the configuration whenever the config file changes. The
+// directory is watched rather than the file so editors and config management
+// tools that replace the file by renaming it are picked up. Events are
+// debounced so a file that's written in several steps is only read once it's
+// complete.
+func Watch() error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		var debounce <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(file) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					debounce = time.After(watchDebounce)
+				}
+			case <-debounce:
+				debounce = nil
+				ReloadAndLog()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Error(err)
+			}
+		}
+	}()
+
+	return nil
+}
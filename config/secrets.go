@@ -0,0 +1,19 @@
+package config
+
+import (
+	sec "github.com/davepgreene/propsd-agent/secrets"
+	"github.com/spf13/viper"
+)
+
+// Decrypter builds the decrypter for the configured secrets provider. It
+// returns nil when no provider is configured.
+//
+// NOTE: This should only be called after viper initializes
+func Decrypter() (sec.Decrypter, error) {
+	switch viper.GetString("secrets.provider") {
+	case "local":
+		return sec.NewLocal(viper.GetString("secrets.local.key_file"))
+	default:
+		return nil, nil
+	}
+}
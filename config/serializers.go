@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/davepgreene/propsd-agent/serializers"
+	"github.com/spf13/viper"
+)
+
+// SerializerOptions builds the flattening, .properties and environment
+// variable options from the conqueso and env settings.
+//
+// NOTE: This should only be called after viper initializes
+func SerializerOptions() serializers.Options {
+	c, _, _ := load(viper.GetViper())
+	return c.SerializerOptions()
+}
+
+// SerializerOptions builds the flattening, .properties and environment
+// variable options from c's conqueso and env settings.
+func (c *Config) SerializerOptions() serializers.Options {
+	return serializers.Options{
+		Flatten: serializers.FlattenOptions{
+			Separator: c.Conqueso.Separator,
+			Arrays:    serializers.ArrayStyle(c.Conqueso.Arrays),
+			Join:      c.Conqueso.Join,
+			Include:   c.Conqueso.Include,
+			Exclude:   c.Conqueso.Exclude,
+		},
+		Properties: serializers.PropertiesOptions{
+			Encoding: serializers.Encoding(c.Conqueso.Encoding),
+		},
+		Env: serializers.EnvOptions{
+			Prefix:      c.Env.Prefix,
+			Case:        c.Env.Case,
+			Replacement: c.Env.Replacement,
+		},
+	}
+}
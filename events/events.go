@@ -0,0 +1,85 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Event is something that happened to the instance that local services may
+// want to react to.
+type Event struct {
+	ID     uint64            `json:"id"`
+	Type   string            `json:"type"`
+	Time   time.Time         `json:"time"`
+	Detail map[string]string `json:"detail,omitempty"`
+}
+
+// historySize is how many of the most recent events are kept for Since.
+const historySize = 100
+
+var (
+	mu          sync.Mutex
+	history     []Event
+	lastID      uint64
+	subscribers []func(Event)
+)
+
+// Publish records an event, logs it and hands it to every subscriber. Each
+// subscriber is called on its own goroutine so a slow one doesn't hold up
+// the publisher or the others.
+func Publish(typ string, detail map[string]string) Event {
+	mu.Lock()
+	lastID++
+	e := Event{
+		ID:     lastID,
+		Type:   typ,
+		Time:   time.Now(),
+		Detail: detail,
+	}
+	history = append(history, e)
+	if len(history) > historySize {
+		history = history[len(history)-historySize:]
+	}
+	subs := subscribers
+	mu.Unlock()
+
+	fields := log.Fields{"event": typ}
+	for k, v := range detail {
+		fields[k] = v
+	}
+	log.WithFields(fields).Info("Published event")
+
+	for _, fn := range subs {
+		go fn(e)
+	}
+
+	return e
+}
+
+// Since returns the recorded events with an ID greater than id, oldest first.
+func Since(id uint64) []Event {
+	mu.Lock()
+	defer mu.Unlock()
+
+	found := []Event{}
+	for _, e := range history {
+		if e.ID > id {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Subscribe calls fn with every event published from now on.
+func Subscribe(fn func(Event)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Publish reads the slice without holding the lock, so it's replaced
+	// rather than appended to in place.
+	subs := make([]func(Event), len(subscribers), len(subscribers)+1)
+	copy(subs, subscribers)
+	subscribers = append(subs, fn)
+}
@@ -0,0 +1,123 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// Start runs the configured hooks for every event published from now on. The
+// hooks are read from the current configuration as each event arrives, so a
+// reload takes effect with the next event.
+func Start() {
+	events.Subscribe(func(e events.Event) {
+		c := config.Current().Hooks
+		for _, hook := range c.Handlers {
+			if matches(hook, e) {
+				go run(hook, e, c.Timeout)
+			}
+		}
+	})
+}
+
+// matches reports whether hook should run for e. A hook that doesn't name
+// any events runs for all of them.
+func matches(hook config.Hook, e events.Event) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, typ := range hook.Events {
+		if typ == e.Type {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run runs hook for e, giving up after timeout unless it's zero.
+func run(hook config.Hook, e events.Event, timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"event": e.Type,
+			"error": err,
+		}).Error("Unable to encode event for hook")
+		return
+	}
+
+	fields := log.Fields{"event": e.Type, "id": e.ID}
+	if hook.URL != "" {
+		fields["url"] = hook.URL
+		err = post(ctx, hook.URL, body)
+	} else {
+		fields["command"] = hook.Command
+		err = command(ctx, hook.Command, e, body)
+	}
+	if err != nil {
+		fields["error"] = err
+		log.WithFields(fields).Error("Hook failed")
+		return
+	}
+
+	log.WithFields(fields).Info("Ran hook")
+}
+
+// post sends the event to url as JSON. Any response other than a 2xx is a
+// failure.
+func post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// command runs args with the event on stdin. The event's type and ID are
+// also put in the environment for scripts that don't need the rest.
+func command(ctx context.Context, args []string, e events.Event, body []byte) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"PROPSD_EVENT_TYPE="+e.Type,
+		"PROPSD_EVENT_ID="+strconv.FormatUint(e.ID, 10),
+	)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/davepgreene/propsd-agent/events"
+	"github.com/gorilla/handlers"
+)
+
+type eventsHandler struct{}
+
+func newEventsHandler() http.Handler {
+	return handlers.MethodHandler{
+		"GET": &eventsHandler{},
+	}
+}
+
+// ServeHTTP responds with the recent events, oldest first. Passing the ID of
+// the last event seen as `since` returns only the ones after it.
+func (h *eventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var since uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			b, _ := json.Marshal(map[string]string{"error": "since must be an event ID"})
+			w.Write(b)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.Marshal(events.Since(since))
+	w.Write(b)
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/serializers"
+	log "github.com/sirupsen/logrus"
+)
+
+// writeDocument serializes a JSON properties document in the format requested
+// by the `format` query parameter or the Accept header, falling back to def.
+func writeDocument(rw http.ResponseWriter, r *http.Request, body []byte, def serializers.Format) {
+	rw.Header().Add("Vary", "Accept")
+
+	// An Accept header that names no supported format gets def, as these
+	// endpoints only ever served def before formats could be negotiated.
+	format, _, err := serializers.Negotiate(r.URL.Query().Get("format"), r.Header.Get("Accept"), def)
+	if err != nil {
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+
+	rw.Header().Set("Content-Type", format.ContentType())
+
+	if len(body) == 0 {
+		rw.WriteHeader(http.StatusGone)
+		rw.Write([]byte(""))
+		return
+	}
+
+	// Raw JSON is passed through untouched.
+	if format == serializers.JSON {
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(body)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"format": format,
+	}).Info("Transforming properties")
+
+	data, err := serializers.Decode(body)
+	if err != nil {
+		log.Error(err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(""))
+		return
+	}
+
+	b, err := serializers.Serialize(data, format, config.Current().SerializerOptions())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"format": format,
+			"error":  err,
+		}).Error("Unable to serialize properties")
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(""))
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(b)
+}
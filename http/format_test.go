@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davepgreene/propsd-agent/serializers"
+)
+
+func TestWriteDocumentFallsBackToTheDefault(t *testing.T) {
+	body := []byte(`{"a":"1"}`)
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"no Accept header", "/v1/properties", "", http.StatusOK, "application/json"},
+		{"JSON", "/v1/properties", "application/json", http.StatusOK, "application/json"},
+		{"text/plain", "/v1/properties", "text/plain", http.StatusOK, "application/json"},
+		{"unsupported Accept header", "/v1/properties", "application/xml", http.StatusOK, "application/json"},
+		{"unknown format parameter", "/v1/properties?format=xml", "", http.StatusBadRequest, "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			writeDocument(rw, r, body, serializers.JSON)
+			if rw.Code != tt.code {
+				t.Errorf("got status %d, want %d", rw.Code, tt.code)
+			}
+			if got := rw.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got Content-Type %q, want %q", got, tt.contentType)
+			}
+			if tt.code == http.StatusOK && rw.Body.String() != string(body) {
+				t.Errorf("got body %q, want %q", rw.Body.String(), body)
+			}
+		})
+	}
+}
@@ -1,11 +1,18 @@
 package http
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"time"
 
 	"encoding/json"
+	"github.com/davepgreene/propsd-agent/auth"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/scheduler"
 	"github.com/davepgreene/propsd-agent/sources"
 	"github.com/davepgreene/propsd-agent/utils"
 	"github.com/gorilla/mux"
@@ -17,17 +24,29 @@ import (
 	"github.com/urfave/negroni"
 )
 
-// Handler returns an http.Handler for the API.
-func Handler(metadata *sources.Metadata) {
+// Handler returns an http.Handler for the API. Sections are added to the
+// document sent upstream alongside the instance metadata.
+func Handler(metadata sources.MetadataProvider, sections ...sources.Section) {
 	r := mux.NewRouter()
 	statsMiddleware := stats.New()
 	r.HandleFunc("/stats", newAdminHandler(statsMiddleware).ServeHTTP)
 
 	v1 := r.PathPrefix("/v1").Subrouter()
 	v1.HandleFunc("/metadata", newMetadataHandler(metadata).ServeHTTP)
+	v1.Handle("/admin/refresh", newRefreshHandler())
+	v1.Handle("/events", newEventsHandler())
 
-	prox := proxy(viper.GetString("propsd.upstream"))
-	chain := alice.New(metadataMiddleware(metadata)).Append(prox)
+	upstream := newUpstream(metadata, sections)
+	chain := alice.New(proxy(upstream))
+
+	// Keep the cached properties and upstream status fresh between requests.
+	// The first fetch doesn't wait for an interval so health reflects the
+	// upstream soon after startup.
+	refresh := scheduler.New("upstream", func() { upstream.Refresh() }, func() time.Duration {
+		return config.Current().Propsd.Interval
+	}, viper.GetFloat64("scheduler.jitter"))
+	go refresh.RunNow()
+	refresh.Start(context.Background())
 
 	// Conqueso handler
 	v1.Handle("/conqueso", chain.ThenFunc(newConquesoHandler().ServeHTTP))
@@ -36,22 +55,22 @@ func Handler(metadata *sources.Metadata) {
 	v1.Handle("/properties", chain.ThenFunc(newPropertiesHandler().ServeHTTP))
 
 	// Core handlers
-	v1.Handle("/health", chain.ThenFunc(
-		newStatusHandler(metadata, statsMiddleware, func(h *statusHandler, w http.ResponseWriter, r *http.Request) {
+	v1.Handle("/health",
+		newStatusHandler(metadata, upstream, statsMiddleware, func(h *statusHandler, w http.ResponseWriter, r *http.Request) {
 			_, code := h.GenerateStatus(w, r)
 			w.WriteHeader(code)
 			w.Write([]byte(""))
-		}).ServeHTTP))
+		}))
 
-	v1.Handle("/status", chain.ThenFunc(
-		newStatusHandler(metadata, statsMiddleware, func(h *statusHandler, w http.ResponseWriter, r *http.Request) {
+	v1.Handle("/status",
+		newStatusHandler(metadata, upstream, statsMiddleware, func(h *statusHandler, w http.ResponseWriter, r *http.Request) {
 			status, code := h.GenerateStatus(w, r)
 			w.WriteHeader(code)
 
 			status.Code = code
 			b, _ := json.Marshal(status)
 			w.Write(b)
-		}).ServeHTTP))
+		}))
 
 	// Define our 404 handler
 	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
@@ -64,6 +83,25 @@ func Handler(metadata *sources.Metadata) {
 		n.Use(negronilogrus.NewCustomMiddleware(utils.GetLogLevel(), utils.GetLogFormatter(), "requests"))
 	}
 
+	// Access rules are re-read, along with the token file, whenever the
+	// config reloads.
+	tokens, rules, err := auth.Load(config.Current().Auth)
+	if err != nil {
+		log.Fatal(err)
+	}
+	guard := auth.NewGuard(tokens, rules)
+	config.OnReload(func(c *config.Config) {
+		tokens, rules, err := auth.Load(c.Auth)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Error("Unable to reload access rules. Keeping the current ones.")
+			return
+		}
+		guard.Set(tokens, rules)
+	})
+	n.Use(guard)
+
 	n.Use(statsMiddleware)
 	n.UseHandler(r)
 
@@ -76,17 +114,85 @@ func Handler(metadata *sources.Metadata) {
 		ReadHeaderTimeout: 10 * time.Second,
 		Addr:              conn,
 		Handler:           n,
+		ConnContext:       auth.ConnContext,
+	}
+
+	if certFile := viper.GetString("service.tls.cert"); certFile != "" {
+		cert, err := newCertificate(certFile, viper.GetString("service.tls.key"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.TLSConfig = &tls.Config{GetCertificate: cert.GetCertificate}
+
+		config.OnReload(func(c *config.Config) {
+			if err := cert.load(c.Service.TLS.Cert, c.Service.TLS.Key); err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Error("Unable to reload TLS certificate. Keeping the current one.")
+			}
+		})
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			log.Fatal(err)
 		}
 	}()
 
+	// Optionally listen on a Unix socket as well so local clients don't need
+	// the TCP port.
+	if socket := viper.GetString("service.socket"); socket != "" {
+		l, err := listenUnix(socket)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info(fmt.Sprintf("Listening on %s", socket))
+
+		go func() {
+			if err := server.Serve(l); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
 	shutdown(server)
 }
 
+// socketMode lets the agent's user and group connect to the Unix socket.
+// Access rules can name the users and groups that connect over it, so it
+// isn't left to the umask.
+const socketMode = 0660
+
+// listenUnix listens on a Unix socket at path, replacing a socket left behind
+// by an earlier run. Anything else at path is left alone.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
 // notFoundHandler provides a standard response for unhandled paths
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
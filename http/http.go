@@ -4,9 +4,10 @@ import (
 	"time"
 	"net/http"
 	"github.com/thoas/stats"
+	"github.com/davepgreene/propsd-agent/scheduler"
 	"github.com/davepgreene/propsd-agent/sources"
+	"github.com/davepgreene/propsd-agent/status"
 	prox "github.com/davepgreene/propsd-agent/proxy"
-	"io/ioutil"
 	"github.com/gorilla/handlers"
 )
 
@@ -17,17 +18,21 @@ type Status struct {
 	Metadata bool `json:"metadata"`
 	Proxy bool `json:"proxy"`
 	Body bool `json:"body"`
+	Components map[string]status.Report `json:"components"`
+	MetadataAge map[string]string `json:"metadata-age"`
+	Schedulers map[string]scheduler.Stats `json:"schedulers"`
 }
 
 type statusHandler struct {
-	metadata *sources.Metadata
+	metadata sources.MetadataProvider
+	upstream *prox.Upstream
 	stats *stats.Stats
 	fn func(*statusHandler, http.ResponseWriter, *http.Request)
 }
 
-func newStatusHandler(metadata *sources.Metadata, s *stats.Stats, fn func(h *statusHandler, w http.ResponseWriter, r *http.Request)) http.Handler {
+func newStatusHandler(metadata sources.MetadataProvider, upstream *prox.Upstream, s *stats.Stats, fn func(h *statusHandler, w http.ResponseWriter, r *http.Request)) http.Handler {
 	return handlers.MethodHandler{
-		"GET": &statusHandler{metadata, s, fn},
+		"GET": &statusHandler{metadata, upstream, s, fn},
 	}
 }
 
@@ -35,25 +40,39 @@ func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.fn(h, w, r)
 }
 
+// GenerateStatus summarises the state the scheduled refreshes have left
+// behind. It never calls the upstream or a metadata service itself, so health
+// checks stay cheap.
 func (h *statusHandler) GenerateStatus(w http.ResponseWriter, r *http.Request) (Status, int) {
-	defer r.Body.Close()
-	body, _ := ioutil.ReadAll(r.Body)
+	components := status.Reports()
 
-	// See comment in proxy/proxy.go
-	upstream := w.Header().Get(prox.UpstreamHeader)
-	w.Header().Del(prox.UpstreamHeader)
+	schedulers := make(map[string]scheduler.Stats)
+	for _, name := range scheduler.Names() {
+		if sch, ok := scheduler.Get(name); ok {
+			schedulers[name] = sch.Stats()
+		}
+	}
 
-	status := Status{
+	s := Status{
 		Version: "0.0.0",
 		Uptime: h.stats.Uptime.Format(time.RFC3339),
-		Metadata: h.metadata.Ok(),
-		Proxy: upstream == "true",
-		Body: len(body) != 0,
+		Metadata: h.metadata.Ok() && !unavailable(components["metadata"]),
+		Proxy: !unavailable(components["upstream"]),
+		Body: h.upstream.Data() != "",
+		Components: components,
+		MetadataAge: h.metadata.Properties().Ages(),
+		Schedulers: schedulers,
 	}
 
-	if !status.Metadata || !status.Proxy || !status.Body {
-		return status, http.StatusInternalServerError
+	if !s.Metadata || !s.Proxy || !s.Body {
+		return s, http.StatusInternalServerError
 	}
 
-	return status, http.StatusOK
-}
\ No newline at end of file
+	return s, http.StatusOK
+}
+
+// unavailable reports whether a component has nothing to serve, because it
+// has failed or been throttled since it started.
+func unavailable(r status.Report) bool {
+	return r.State == status.StateFailed || (r.State == status.StateThrottled && r.LastSuccess == nil)
+}
@@ -3,15 +3,17 @@ package http
 import (
 	"github.com/gorilla/handlers"
 	"net/http"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/parsers"
 	"github.com/davepgreene/propsd-agent/sources"
 	"encoding/json"
 )
 
 type metadataHandler struct{
-	metadata *sources.Metadata
+	metadata sources.MetadataProvider
 }
 
-func newMetadataHandler(m *sources.Metadata) http.Handler {
+func newMetadataHandler(m sources.MetadataProvider) http.Handler {
 	return handlers.MethodHandler{
 		"GET": &metadataHandler{m},
 	}
@@ -19,8 +21,36 @@ func newMetadataHandler(m *sources.Metadata) http.Handler {
 
 func (h *metadataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	m := h.metadata
+	if s, ok := m.(*sources.SwitchableProvider); ok {
+		m = s.Provider()
+	}
+	p := m.Properties()
+	if aws, ok := m.(*sources.Metadata); ok {
+		aws.CredentialsExpired(p)
+	}
+	fields, err := p.Filter(metadataFields("endpoint"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
-	b, _ := json.Marshal(h.metadata.Properties())
+	b, _ := json.Marshal(fields)
 
 	w.Write(b)
 }
+
+// metadataFields returns the fields exposed to a consumer of the instance
+// metadata, either the "endpoint" or the "upstream".
+func metadataFields(consumer string) parsers.FieldFilter {
+	fields := config.Current().Metadata.Fields.Endpoint
+	if consumer == "upstream" {
+		fields = config.Current().Metadata.Fields.Upstream
+	}
+
+	return parsers.FieldFilter{
+		Include: fields.Include,
+		Exclude: fields.Exclude,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/gorilla/handlers"
 	"net/http"
 	"io/ioutil"
+	"github.com/davepgreene/propsd-agent/serializers"
 )
 
 type propertiesHandler struct{}
@@ -18,15 +19,5 @@ func (h *propertiesHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	body, _ := ioutil.ReadAll(r.Body)
 
-	rw.Header().Set("Content-Type", "application/json")
-	var status int
-
-	if len(body) > 0 {
-		status = http.StatusOK
-	} else {
-		status = http.StatusGone
-	}
-
-	rw.WriteHeader(status)
-	rw.Write(body)
+	writeDocument(rw, r, body, serializers.JSON)
 }
@@ -2,41 +2,52 @@ package http
 
 import (
 	"net/http"
+	"github.com/davepgreene/propsd-agent/config"
 	prox "github.com/davepgreene/propsd-agent/proxy"
 	"github.com/davepgreene/propsd-agent/sources"
 	"github.com/justinas/alice"
 	"github.com/spf13/viper"
 	"encoding/json"
-	"io/ioutil"
-	"bytes"
-	"strconv"
 )
 
-type metadataProxyHandler struct {
-	handler http.Handler
-	metadata *sources.Metadata
-}
+// upstreamPayload builds the document sent to the upstream with each request
+// from the instance metadata fields it's allowed to see, any sections that
+// have something to add and the image properties.
+func upstreamPayload(m sources.MetadataProvider, sections []sources.Section) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		instance, err := m.Properties().Filter(metadataFields("upstream"))
+		if err != nil {
+			return nil, err
+		}
 
-func (p *metadataProxyHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	properties := make(map[string]interface{})
-	properties["instance"] = p.metadata.Properties()
-	properties["image"] = viper.GetStringMap("properties.image")
-	propertiesJSON, _ := json.Marshal(properties)
+		properties := make(map[string]interface{})
+		properties["instance"] = instance
+		for _, s := range sections {
+			if v := s.Value(); v != nil {
+				properties[s.Key()] = v
+			}
+		}
+		image, _ := config.Current().Properties["image"].(map[string]interface{})
+		if image == nil {
+			image = map[string]interface{}{}
+		}
+		properties["image"] = image
 
-	r.Body = ioutil.NopCloser(bytes.NewReader(propertiesJSON))
-	r.ContentLength = int64(len(propertiesJSON))
-	r.Header.Set("Content-Length", strconv.Itoa(len(propertiesJSON)))
-	p.handler.ServeHTTP(rw, r)
+		return json.Marshal(properties)
+	}
 }
 
-func metadataMiddleware(m *sources.Metadata) alice.Constructor {
-	return func(handler http.Handler) http.Handler {
-		return &metadataProxyHandler{handler, m}
-	}
+func newUpstream(m sources.MetadataProvider, sections []sources.Section) *prox.Upstream {
+	u := prox.NewUpstream(viper.GetString("propsd.upstream"), upstreamPayload(m, sections))
+	config.OnReload(func(c *config.Config) {
+		u.SetURL(c.Propsd.Upstream)
+	})
+
+	return u
 }
 
-func proxy(url string) alice.Constructor {
+func proxy(u *prox.Upstream) alice.Constructor {
 	return func(handler http.Handler) http.Handler {
-		return prox.New(url, handler)
+		return prox.New(u, handler)
 	}
-}
\ No newline at end of file
+}
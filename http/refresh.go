@@ -0,0 +1,115 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/davepgreene/propsd-agent/scheduler"
+	"github.com/davepgreene/propsd-agent/status"
+	"github.com/gorilla/handlers"
+)
+
+// refreshTargets maps each refresh target to the components it updates, in
+// the order targets run for "all". ASG and tags depend on the instance ID
+// and region, so metadata runs first, and the ASG is usually named in the
+// tags.
+var refreshTargets = []struct {
+	name       string
+	components []string
+}{
+	{"metadata", []string{"metadata"}},
+	{"credentials", []string{"credentials"}},
+	{"tags", []string{"tags"}},
+	{"asg", []string{"asg"}},
+	{"notices", []string{"notices"}},
+	{"ecs", []string{"ecs"}},
+	{"kubernetes", []string{"kubernetes"}},
+	{"upstream", []string{"upstream"}},
+}
+
+type RefreshResult struct {
+	Refreshed  []string                 `json:"refreshed"`
+	Components map[string]status.Report `json:"components"`
+}
+
+type refreshHandler struct{}
+
+func newRefreshHandler() http.Handler {
+	return handlers.MethodHandler{
+		"POST": &refreshHandler{},
+	}
+}
+
+// ServeHTTP runs the requested refreshes immediately and responds with the
+// status of the components they updated. Targets are given as one or more
+// `target` query parameters, which may also be comma separated, and default
+// to all.
+func (h *refreshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	requested := make(map[string]bool)
+	for _, t := range r.URL.Query()["target"] {
+		for _, name := range strings.Split(t, ",") {
+			requested[strings.TrimSpace(name)] = true
+		}
+	}
+	all := len(requested) == 0 || requested["all"]
+	delete(requested, "all")
+
+	for name := range requested {
+		if !knownTarget(name) {
+			w.WriteHeader(http.StatusBadRequest)
+			b, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("unknown refresh target %q", name)})
+			w.Write(b)
+			return
+		}
+	}
+
+	result := RefreshResult{
+		Refreshed:  []string{},
+		Components: make(map[string]status.Report),
+	}
+
+	code := http.StatusOK
+	for _, target := range refreshTargets {
+		if !all && !requested[target.name] {
+			continue
+		}
+
+		s, ok := scheduler.Get(target.name)
+		if !ok {
+			continue
+		}
+		s.RunNow()
+		result.Refreshed = append(result.Refreshed, target.name)
+
+		reports := status.Reports()
+		for _, name := range target.components {
+			// Not every metadata provider has every component.
+			report, ok := reports[name]
+			if !ok {
+				continue
+			}
+			result.Components[name] = report
+			if report.State == status.StateFailed {
+				code = http.StatusInternalServerError
+			}
+		}
+	}
+
+	w.WriteHeader(code)
+	b, _ := json.Marshal(result)
+	w.Write(b)
+}
+
+func knownTarget(name string) bool {
+	for _, target := range refreshTargets {
+		if target.name == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -8,14 +8,21 @@ import (
 	"net/http"
 	"context"
 	log "github.com/sirupsen/logrus"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/scheduler"
 )
 
 func shutdown(s *http.Server) {
 	c := make(chan os.Signal, 1)
 
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-	<-c
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		config.ReloadAndLog()
+	}
 
 	var timeout time.Duration
 
@@ -37,4 +44,7 @@ func shutdown(s *http.Server) {
 	} else {
 		log.Info("Server stopped")
 	}
+
+	scheduler.StopAll()
+	log.Info("Schedulers stopped")
 }
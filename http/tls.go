@@ -0,0 +1,42 @@
+package http
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// certificate holds the server's TLS certificate so it can be swapped when
+// the configuration is reloaded without restarting the listener.
+type certificate struct {
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertificate(certFile, keyFile string) (*certificate, error) {
+	c := &certificate{}
+	if err := c.load(certFile, keyFile); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *certificate) load(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+
+	return nil
+}
+
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
@@ -0,0 +1,103 @@
+package parsers
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/davepgreene/propsd-agent/utils"
+)
+
+// EC2 tags instances launched from a launch template with the template and
+// the version they were launched from.
+const (
+	launchTemplateIDTag      = "aws:ec2launchtemplate:id"
+	launchTemplateVersionTag = "aws:ec2launchtemplate:version"
+)
+
+// MetadataPropertiesAutoScaling describes the instance's place in its auto
+// scaling group.
+type MetadataPropertiesAutoScaling struct {
+	LifecycleState        string            `json:"lifecycle-state,omitempty"`
+	HealthStatus          string            `json:"health-status,omitempty"`
+	LaunchConfiguration   string            `json:"launch-configuration,omitempty"`
+	LaunchTemplateID      string            `json:"launch-template-id,omitempty"`
+	LaunchTemplateVersion string            `json:"launch-template-version,omitempty"`
+	Tags                  map[string]string `json:"tags,omitempty"`
+}
+
+// errRegionUnknown is returned until the identity document has been read, as
+// the autoscaling API can't be called without the instance's region.
+var errRegionUnknown = errors.New("the instance's region isn't known yet, so its auto scaling group can't be looked up")
+
+// describeAutoScaling looks up the auto scaling group the instance belongs
+// to. When the group is already known, from the instance's tags or an earlier
+// lookup, it takes one call to the autoscaling API, otherwise two. An empty
+// group name means the instance isn't in a group.
+func describeAutoScaling(s *session.Session, current *MetadataProperties) (string, *MetadataPropertiesAutoScaling, error) {
+	if current.Region == "" {
+		return "", nil, errRegionUnknown
+	}
+
+	client := autoscaling.New(s, aws.NewConfig().WithRegion(current.Region))
+	utils.RateLimited(client.Client)
+
+	group, ok := current.Tags[autoScalingGroupTag]
+	if !ok {
+		group = current.AutoScalingGroup
+	}
+	if group == "" {
+		result, err := client.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: []*string{aws.String(current.InstanceID)},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if len(result.AutoScalingInstances) == 0 {
+			return "", nil, nil
+		}
+		group = aws.StringValue(result.AutoScalingInstances[0].AutoScalingGroupName)
+	}
+
+	result, err := client.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(group)},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if len(result.AutoScalingGroups) == 0 {
+		return "", nil, nil
+	}
+	g := result.AutoScalingGroups[0]
+
+	// The group tag stays on instances that have been detached, so the
+	// instance only counts as a member if the group still lists it. Dropping
+	// the group from the snapshot means the next lookup starts over.
+	var instance *autoscaling.Instance
+	for _, i := range g.Instances {
+		if aws.StringValue(i.InstanceId) == current.InstanceID {
+			instance = i
+			break
+		}
+	}
+	if instance == nil {
+		return "", nil, nil
+	}
+
+	details := &MetadataPropertiesAutoScaling{
+		LifecycleState:        aws.StringValue(instance.LifecycleState),
+		HealthStatus:          aws.StringValue(instance.HealthStatus),
+		LaunchConfiguration:   aws.StringValue(instance.LaunchConfigurationName),
+		LaunchTemplateID:      current.Tags[launchTemplateIDTag],
+		LaunchTemplateVersion: current.Tags[launchTemplateVersionTag],
+	}
+	for _, tag := range g.Tags {
+		if details.Tags == nil {
+			details.Tags = make(map[string]string)
+		}
+		details.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	return group, details, nil
+}
@@ -0,0 +1,117 @@
+package parsers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const describeGroupsResponse = `<DescribeAutoScalingGroupsResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+<DescribeAutoScalingGroupsResult><AutoScalingGroups><member>
+<AutoScalingGroupName>web</AutoScalingGroupName>
+<Instances><member><InstanceId>i-abc</InstanceId><LifecycleState>InService</LifecycleState><HealthStatus>Healthy</HealthStatus></member></Instances>
+<Tags><member><Key>team</Key><Value>platform</Value></member></Tags>
+</member></AutoScalingGroups></DescribeAutoScalingGroupsResult>
+</DescribeAutoScalingGroupsResponse>`
+
+const describeInstancesResponse = `<DescribeAutoScalingInstancesResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+<DescribeAutoScalingInstancesResult><AutoScalingInstances><member>
+<InstanceId>i-abc</InstanceId><AutoScalingGroupName>web</AutoScalingGroupName>
+</member></AutoScalingInstances></DescribeAutoScalingInstancesResult>
+</DescribeAutoScalingInstancesResponse>`
+
+// autoScalingAPI fakes the autoscaling API and records the actions called.
+func autoScalingAPI(t *testing.T) (*session.Session, func() []string) {
+	var mu sync.Mutex
+	var actions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		action := r.Form.Get("Action")
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+
+		switch action {
+		case "DescribeAutoScalingGroups":
+			fmt.Fprint(w, describeGroupsResponse)
+		case "DescribeAutoScalingInstances":
+			fmt.Fprint(w, describeInstancesResponse)
+		default:
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	s := session.Must(session.NewSession(aws.NewConfig().
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithMaxRetries(0)))
+
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), actions...)
+	}
+}
+
+func TestDescribeAutoScaling(t *testing.T) {
+	tests := []struct {
+		name    string
+		current *MetadataProperties
+		actions []string
+	}{
+		{
+			"group from the tags",
+			&MetadataProperties{InstanceID: "i-abc", Region: "us-east-1", Tags: map[string]string{autoScalingGroupTag: "web"}},
+			[]string{"DescribeAutoScalingGroups"},
+		},
+		{
+			"group from an earlier lookup",
+			&MetadataProperties{InstanceID: "i-abc", Region: "us-east-1", AutoScalingGroup: "web"},
+			[]string{"DescribeAutoScalingGroups"},
+		},
+		{
+			"group unknown",
+			&MetadataProperties{InstanceID: "i-abc", Region: "us-east-1"},
+			[]string{"DescribeAutoScalingInstances", "DescribeAutoScalingGroups"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, actions := autoScalingAPI(t)
+
+			group, details, err := describeAutoScaling(s, tt.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if group != "web" {
+				t.Errorf("got group %q, want web", group)
+			}
+			if details == nil || details.LifecycleState != "InService" || details.Tags["team"] != "platform" {
+				t.Errorf("got details %+v", details)
+			}
+			if got := actions(); fmt.Sprint(got) != fmt.Sprint(tt.actions) {
+				t.Errorf("called %v, want %v", got, tt.actions)
+			}
+		})
+	}
+}
+
+func TestDescribeAutoScalingWithoutRegion(t *testing.T) {
+	s, actions := autoScalingAPI(t)
+
+	_, _, err := describeAutoScaling(s, &MetadataProperties{InstanceID: "i-abc", AutoScalingGroup: "web"})
+	if err != errRegionUnknown {
+		t.Errorf("got error %v, want %v", err, errRegionUnknown)
+	}
+	if got := actions(); len(got) != 0 {
+		t.Errorf("called %v without a region", got)
+	}
+}
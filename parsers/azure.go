@@ -0,0 +1,111 @@
+package parsers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// NewAzureMetadataParser returns the parser for the Azure instance metadata
+// service's instance document, which is parsed under the ProviderAzure path.
+func NewAzureMetadataParser() *Metadata {
+	m := newMetadata()
+	m.Parsers = map[string]MetadataParser{
+		ProviderAzure: tracked(ProviderAzure, parseAzure),
+	}
+
+	return m
+}
+
+func parseAzure(body string) (MetadataUpdate, error) {
+	var document struct {
+		Compute struct {
+			Location       string
+			Zone           string
+			VMID           string `json:"vmId"`
+			VMSize         string
+			SubscriptionID string
+			Name           string
+			OSProfile      struct {
+				ComputerName string
+			}
+			TagsList []struct {
+				Name  string
+				Value string
+			}
+		}
+		Network struct {
+			Interface []struct {
+				MACAddress string
+				IPv4       struct {
+					IPAddress []struct {
+						PrivateIPAddress string
+						PublicIPAddress  string
+					}
+					Subnet []struct {
+						Address string
+						Prefix  string
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		return nil, err
+	}
+	compute := document.Compute
+
+	var tags map[string]string
+	for _, tag := range compute.TagsList {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[tag.Name] = tag.Value
+	}
+
+	hostname := compute.OSProfile.ComputerName
+	if hostname == "" {
+		hostname = compute.Name
+	}
+
+	var iface *MetadataPropertiesInterface
+	if len(document.Network.Interface) > 0 {
+		n := document.Network.Interface[0]
+		var private, public []string
+		for _, addr := range n.IPv4.IPAddress {
+			if addr.PrivateIPAddress != "" {
+				private = append(private, addr.PrivateIPAddress)
+			}
+			if addr.PublicIPAddress != "" {
+				public = append(public, addr.PublicIPAddress)
+			}
+		}
+
+		// Like the EC2 metadata service, multiple addresses are newline
+		// separated.
+		iface = &MetadataPropertiesInterface{
+			MAC:         n.MACAddress,
+			LocalIPV4s:  strings.Join(private, "\n"),
+			PublicIPV4s: strings.Join(public, "\n"),
+		}
+		if len(n.IPv4.Subnet) > 0 && n.IPv4.Subnet[0].Address != "" {
+			iface.SubnetIPV4CIDRBlock = n.IPv4.Subnet[0].Address + "/" + n.IPv4.Subnet[0].Prefix
+		}
+	}
+
+	return func(p *MetadataProperties) {
+		p.Provider = ProviderAzure
+		p.Account = compute.SubscriptionID
+		p.Region = compute.Location
+		p.AvailabilityZone = compute.Zone
+		p.InstanceID = compute.VMID
+		p.InstanceType = compute.VMSize
+		p.Hostname = hostname
+		p.Tags = tags
+		p.Interface = iface
+		p.LocalIPV4, p.PublicIPV4 = "", ""
+		if iface != nil {
+			p.LocalIPV4 = strings.SplitN(iface.LocalIPV4s, "\n", 2)[0]
+			p.PublicIPV4 = strings.SplitN(iface.PublicIPV4s, "\n", 2)[0]
+		}
+	}, nil
+}
@@ -0,0 +1,96 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testAzureDocument is trimmed from the answer to
+// /metadata/instance?api-version=2021-02-01.
+const testAzureDocument = `{
+  "compute": {
+    "location": "westeurope",
+    "zone": "2",
+    "vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+    "vmSize": "Standard_D2s_v3",
+    "subscriptionId": "8d10da13-8125-4ba9-a717-bf7490507b3d",
+    "name": "web-1",
+    "osProfile": {"adminUsername": "azureuser", "computerName": "web-1-host"},
+    "tagsList": [
+      {"name": "role", "value": "web"},
+      {"name": "team", "value": "platform"}
+    ]
+  },
+  "network": {
+    "interface": [
+      {
+        "macAddress": "000D3AF806EC",
+        "ipv4": {
+          "ipAddress": [
+            {"privateIpAddress": "10.0.0.4", "publicIpAddress": "20.50.1.2"},
+            {"privateIpAddress": "10.0.0.5", "publicIpAddress": ""}
+          ],
+          "subnet": [{"address": "10.0.0.0", "prefix": "24"}]
+        }
+      }
+    ]
+  }
+}`
+
+func TestParseAzure(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     MetadataProperties
+	}{
+		{
+			"instance",
+			testAzureDocument,
+			MetadataProperties{
+				Provider:         ProviderAzure,
+				Account:          "8d10da13-8125-4ba9-a717-bf7490507b3d",
+				Region:           "westeurope",
+				AvailabilityZone: "2",
+				InstanceID:       "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+				InstanceType:     "Standard_D2s_v3",
+				Hostname:         "web-1-host",
+				LocalIPV4:        "10.0.0.4",
+				PublicIPV4:       "20.50.1.2",
+				Tags:             map[string]string{"role": "web", "team": "platform"},
+				Interface: &MetadataPropertiesInterface{
+					MAC:                 "000D3AF806EC",
+					LocalIPV4s:          "10.0.0.4\n10.0.0.5",
+					PublicIPV4s:         "20.50.1.2",
+					SubnetIPV4CIDRBlock: "10.0.0.0/24",
+				},
+			},
+		},
+		{
+			"hostname falls back to the name",
+			`{"compute":{"location":"eastus","vmId":"id","name":"web-2"}}`,
+			MetadataProperties{
+				Provider:   ProviderAzure,
+				Region:     "eastus",
+				InstanceID: "id",
+				Hostname:   "web-2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewAzureMetadataParser()
+			m.Update(parse(t, m, ProviderAzure, tt.document))
+
+			got := *m.Properties()
+			got.seen = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewAzureMetadataParser().Parsers[ProviderAzure]("{"); err == nil {
+		t.Error("parsing malformed JSON succeeded")
+	}
+}
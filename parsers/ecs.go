@@ -0,0 +1,53 @@
+package parsers
+
+import (
+	"encoding/json"
+)
+
+// ECSProperties describes the ECS task and container the agent runs in.
+type ECSProperties struct {
+	Cluster       string            `json:"cluster,omitempty"`
+	TaskARN       string            `json:"task-arn,omitempty"`
+	Family        string            `json:"family,omitempty"`
+	Revision      string            `json:"revision,omitempty"`
+	ContainerName string            `json:"container-name,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+// ParseECSTask parses the task document served by the task metadata endpoint
+// at ${ECS_CONTAINER_METADATA_URI_V4}/task or /taskWithTags into p.
+func ParseECSTask(body []byte, p *ECSProperties) error {
+	var task struct {
+		Cluster  string
+		TaskARN  string
+		Family   string
+		Revision string
+		TaskTags map[string]string
+	}
+	if err := json.Unmarshal(body, &task); err != nil {
+		return err
+	}
+
+	p.Cluster = task.Cluster
+	p.TaskARN = task.TaskARN
+	p.Family = task.Family
+	p.Revision = task.Revision
+	p.Tags = task.TaskTags
+
+	return nil
+}
+
+// ParseECSContainer parses the container document served at
+// ${ECS_CONTAINER_METADATA_URI_V4} into p.
+func ParseECSContainer(body []byte, p *ECSProperties) error {
+	var container struct {
+		Name string
+	}
+	if err := json.Unmarshal(body, &container); err != nil {
+		return err
+	}
+
+	p.ContainerName = container.Name
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package parsers
+
+import (
+	"time"
+)
+
+// fields lists the MetadataProperties fields each source path populates, named
+// as they appear in the JSON document.
+var fields = map[string][]string{
+	"instance-identity/document": {"identity", "provider", "account", "region", "availability-zone", "ami-id", "instance-id", "instance-type"},
+	"instance-identity/pkcs7":    {"identity"},
+	"hostname":                   {"hostname"},
+	"local-ipv4":                 {"local-ipv4"},
+	"local-hostname":             {"local-hostname"},
+	"public-hostname":            {"public-hostname"},
+	"public-ipv4":                {"public-ipv4"},
+	"reservation-id":             {"reservation-id"},
+	"security-groups":            {"security-groups"},
+	"iam/security-credentials/":  {"iam-role", "credentials"},
+	"network/interfaces/macs/":   {"interface", "vpc-id"},
+	"auto-scaling-group":         {"auto-scaling-group", "auto-scaling"},
+	"tags":                       {"tags"},
+	SpotInstanceActionPath:       {"spot-instance-action"},
+	ScheduledEventsPath:          {"scheduled-events"},
+	TargetLifecycleStatePath:     {"target-lifecycle-state"},
+	ProviderGCE:                  {"provider", "account", "region", "availability-zone", "instance-id", "instance-type", "hostname", "local-ipv4", "public-ipv4", "interface", "vpc-id", "tags"},
+	ProviderAzure:                {"provider", "account", "region", "availability-zone", "instance-id", "instance-type", "hostname", "local-ipv4", "public-ipv4", "interface", "tags"},
+}
+
+// evictions clear the fields a path populates once the source says the path
+// no longer exists.
+var evictions = map[string]MetadataUpdate{
+	"instance-identity/document": func(p *MetadataProperties) {
+		p.Provider = ""
+		p.Account = ""
+		p.Region = ""
+		p.AvailabilityZone = ""
+		p.AmiID = ""
+		p.InstanceID = ""
+		p.InstanceType = ""
+		p.setIdentity(func(i *MetadataPropertiesIdentity) { i.Document = "" })
+	},
+	"instance-identity/pkcs7": func(p *MetadataProperties) {
+		p.setIdentity(func(i *MetadataPropertiesIdentity) { i.Pkcs7 = "" })
+	},
+	"hostname":        func(p *MetadataProperties) { p.Hostname = "" },
+	"local-ipv4":      func(p *MetadataProperties) { p.LocalIPV4 = "" },
+	"local-hostname":  func(p *MetadataProperties) { p.LocalHostname = "" },
+	"public-hostname": func(p *MetadataProperties) { p.PublicHostname = "" },
+	"public-ipv4":     func(p *MetadataProperties) { p.PublicIPV4 = "" },
+	"reservation-id":  func(p *MetadataProperties) { p.ReservationID = "" },
+	"security-groups": func(p *MetadataProperties) { p.SecurityGroups = "" },
+	"iam/security-credentials/": func(p *MetadataProperties) {
+		p.IAMRole = ""
+		p.Credentials = nil
+	},
+	"network/interfaces/macs/": func(p *MetadataProperties) {
+		p.Interface = nil
+		p.VPCID = ""
+	},
+	"auto-scaling-group": func(p *MetadataProperties) {
+		p.AutoScalingGroup = ""
+		p.AutoScaling = nil
+	},
+	"tags":                   func(p *MetadataProperties) { p.Tags = nil },
+	SpotInstanceActionPath:   func(p *MetadataProperties) { p.SpotInstanceAction = nil },
+	ScheduledEventsPath:      func(p *MetadataProperties) { p.ScheduledEvents = nil },
+	TargetLifecycleStatePath: func(p *MetadataProperties) { p.TargetLifecycleState = "" },
+}
+
+// Evict returns an update that clears everything path populated, along with
+// when it was last seen.
+func Evict(path string) MetadataUpdate {
+	evict, ok := evictions[path]
+	if !ok {
+		return nil
+	}
+
+	return func(p *MetadataProperties) {
+		evict(p)
+
+		seen := p.copySeen()
+		for _, field := range fields[path] {
+			// The identity is shared by the document and its signature, so it
+			// stays until both are gone.
+			if field == "identity" && p.Identity != nil {
+				continue
+			}
+			delete(seen, field)
+		}
+		p.seen = seen
+	}
+}
+
+// Ages returns how long ago each populated field was last confirmed by its
+// source.
+func (p *MetadataProperties) Ages() map[string]string {
+	ages := make(map[string]string, len(p.seen))
+	for field, t := range p.seen {
+		ages[field] = time.Since(t).Truncate(time.Second).String()
+	}
+	return ages
+}
+
+// tracked wraps a parser so every update it produces also records when the
+// path's fields were last seen. The time is recorded before the update runs so
+// a parser can still evict its own fields.
+func tracked(path string, parse MetadataParser) MetadataParser {
+	return func(body string) (MetadataUpdate, error) {
+		update, err := parse(body)
+		if err != nil || update == nil {
+			return update, err
+		}
+
+		now := time.Now()
+		return func(p *MetadataProperties) {
+			seen := p.copySeen()
+			for _, field := range fields[path] {
+				seen[field] = now
+			}
+			p.seen = seen
+
+			update(p)
+		}, nil
+	}
+}
+
+// copySeen returns a copy of the last seen times. The map is shared with
+// earlier snapshots, so it's never modified in place.
+func (p *MetadataProperties) copySeen() map[string]time.Time {
+	seen := make(map[string]time.Time, len(p.seen)+1)
+	for field, t := range p.seen {
+		seen[field] = t
+	}
+	return seen
+}
+
+// setIdentity applies fn to a copy of the identity, dropping it entirely once
+// both of its values are gone.
+func (p *MetadataProperties) setIdentity(fn func(*MetadataPropertiesIdentity)) {
+	identity := p.identity()
+	fn(identity)
+	if identity.Document == "" && identity.Pkcs7 == "" {
+		identity = nil
+	}
+	p.Identity = identity
+}
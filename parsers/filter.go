@@ -0,0 +1,87 @@
+package parsers
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// FieldFilter picks which metadata fields are exposed. Fields are named by
+// their path in the JSON document, with nested fields separated by dots, like
+// "credentials.secretAccessKey". Naming a field selects everything under it.
+type FieldFilter struct {
+	// Include limits the document to these fields. An empty list includes
+	// everything.
+	Include []string
+	// Exclude removes these fields after Include is applied.
+	Exclude []string
+}
+
+// Filter returns p as a JSON document limited to the fields f allows.
+func (p *MetadataProperties) Filter(f FieldFilter) (map[string]interface{}, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(f.Include) > 0 {
+		included := make(map[string]interface{})
+		for _, field := range f.Include {
+			if v, ok := lookup(doc, field); ok {
+				set(included, field, v)
+			}
+		}
+		doc = included
+	}
+
+	for _, field := range f.Exclude {
+		remove(doc, field)
+	}
+
+	return doc, nil
+}
+
+func lookup(doc map[string]interface{}, field string) (interface{}, bool) {
+	keys := strings.Split(field, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		doc = next
+	}
+
+	v, ok := doc[keys[len(keys)-1]]
+	return v, ok
+}
+
+func set(doc map[string]interface{}, field string, v interface{}) {
+	keys := strings.Split(field, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			doc[key] = next
+		}
+		doc = next
+	}
+
+	doc[keys[len(keys)-1]] = v
+}
+
+func remove(doc map[string]interface{}, field string) {
+	keys := strings.Split(field, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		doc = next
+	}
+
+	delete(doc, keys[len(keys)-1])
+}
@@ -0,0 +1,124 @@
+package parsers
+
+import (
+	"encoding/json"
+	"net"
+	"path"
+	"strings"
+)
+
+// gceSkipAttributes are instance attributes that hold scripts or keys rather
+// than anything a properties layer would match on, so they aren't copied into
+// the tags.
+var gceSkipAttributes = map[string]bool{
+	"ssh-keys":        true,
+	"sshKeys":         true,
+	"windows-keys":    true,
+	"startup-script":  true,
+	"shutdown-script": true,
+	"user-data":       true,
+	"kube-env":        true,
+}
+
+// NewGCEMetadataParser returns the parser for the GCE metadata server. The
+// whole server is read in one recursive request, which is parsed under the
+// ProviderGCE path.
+func NewGCEMetadataParser() *Metadata {
+	m := newMetadata()
+	m.Parsers = map[string]MetadataParser{
+		ProviderGCE: tracked(ProviderGCE, parseGCE),
+	}
+
+	return m
+}
+
+func parseGCE(body string) (MetadataUpdate, error) {
+	var document struct {
+		Instance struct {
+			ID                json.Number
+			Hostname          string
+			MachineType       string
+			Zone              string
+			Attributes        map[string]string
+			NetworkInterfaces []struct {
+				IP            string
+				MAC           string
+				Network       string
+				Subnetmask    string
+				AccessConfigs []struct {
+					ExternalIP string
+				}
+			}
+		}
+		Project struct {
+			ProjectID string
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		return nil, err
+	}
+	instance := document.Instance
+
+	// Zones and machine types are given as resource paths like
+	// projects/123/zones/us-central1-a.
+	zone := path.Base(instance.Zone)
+	region := zone
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		region = zone[:i]
+	}
+
+	var tags map[string]string
+	for key, value := range instance.Attributes {
+		if gceSkipAttributes[key] {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[key] = value
+	}
+
+	var iface *MetadataPropertiesInterface
+	if len(instance.NetworkInterfaces) > 0 {
+		n := instance.NetworkInterfaces[0]
+		iface = &MetadataPropertiesInterface{
+			MAC:                 n.MAC,
+			LocalIPV4s:          n.IP,
+			SubnetIPV4CIDRBlock: cidrBlock(n.IP, n.Subnetmask),
+			VPCID:               path.Base(n.Network),
+		}
+		if len(n.AccessConfigs) > 0 {
+			iface.PublicIPV4s = n.AccessConfigs[0].ExternalIP
+		}
+	}
+
+	return func(p *MetadataProperties) {
+		p.Provider = ProviderGCE
+		p.Account = document.Project.ProjectID
+		p.Region = region
+		p.AvailabilityZone = zone
+		p.InstanceID = instance.ID.String()
+		p.InstanceType = path.Base(instance.MachineType)
+		p.Hostname = instance.Hostname
+		p.Tags = tags
+		p.Interface = iface
+		p.LocalIPV4, p.PublicIPV4, p.VPCID = "", "", ""
+		if iface != nil {
+			p.LocalIPV4 = iface.LocalIPV4s
+			p.PublicIPV4 = iface.PublicIPV4s
+			p.VPCID = iface.VPCID
+		}
+	}, nil
+}
+
+// cidrBlock returns the network ip is on in CIDR notation, or "" if either
+// address can't be parsed.
+func cidrBlock(ip, mask string) string {
+	addr, m := net.ParseIP(ip).To4(), net.ParseIP(mask).To4()
+	if addr == nil || m == nil {
+		return ""
+	}
+
+	network := net.IPNet{IP: addr.Mask(net.IPMask(m)), Mask: net.IPMask(m)}
+	return network.String()
+}
@@ -0,0 +1,116 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testGCEDocument is trimmed from the answer to
+// /computeMetadata/v1/?recursive=true.
+const testGCEDocument = `{
+  "instance": {
+    "id": 4520031799277581759,
+    "hostname": "web-1.c.shop-prod.internal",
+    "machineType": "projects/123456789/machineTypes/n1-standard-1",
+    "zone": "projects/123456789/zones/us-central1-a",
+    "attributes": {
+      "role": "web",
+      "ssh-keys": "alice:ssh-rsa AAAA alice",
+      "startup-script": "#!/bin/sh\necho hi",
+      "user-data": "#cloud-config"
+    },
+    "networkInterfaces": [
+      {
+        "ip": "10.128.0.2",
+        "mac": "42:01:0a:80:00:02",
+        "network": "projects/123456789/networks/default",
+        "subnetmask": "255.255.240.0",
+        "accessConfigs": [{"externalIp": "35.192.0.1", "type": "ONE_TO_ONE_NAT"}]
+      }
+    ]
+  },
+  "project": {
+    "numericProjectId": 123456789,
+    "projectId": "shop-prod"
+  }
+}`
+
+func TestParseGCE(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     MetadataProperties
+	}{
+		{
+			"instance",
+			testGCEDocument,
+			MetadataProperties{
+				Provider:         ProviderGCE,
+				Account:          "shop-prod",
+				Region:           "us-central1",
+				AvailabilityZone: "us-central1-a",
+				// The ID doesn't fit in a float64, so it mustn't be rounded.
+				InstanceID:   "4520031799277581759",
+				InstanceType: "n1-standard-1",
+				Hostname:     "web-1.c.shop-prod.internal",
+				LocalIPV4:    "10.128.0.2",
+				PublicIPV4:   "35.192.0.1",
+				VPCID:        "default",
+				Tags:         map[string]string{"role": "web"},
+				Interface: &MetadataPropertiesInterface{
+					MAC:                 "42:01:0a:80:00:02",
+					LocalIPV4s:          "10.128.0.2",
+					PublicIPV4s:         "35.192.0.1",
+					SubnetIPV4CIDRBlock: "10.128.0.0/20",
+					VPCID:               "default",
+				},
+			},
+		},
+		{
+			"no network or attributes",
+			`{"instance":{"id":1,"zone":"projects/1/zones/europe-west1-b","machineType":"projects/1/machineTypes/e2-micro","attributes":{"ssh-keys":"k"}},"project":{"projectId":"p"}}`,
+			MetadataProperties{
+				Provider:         ProviderGCE,
+				Account:          "p",
+				Region:           "europe-west1",
+				AvailabilityZone: "europe-west1-b",
+				InstanceID:       "1",
+				InstanceType:     "e2-micro",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewGCEMetadataParser()
+			m.Update(parse(t, m, ProviderGCE, tt.document))
+
+			got := *m.Properties()
+			got.seen = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewGCEMetadataParser().Parsers[ProviderGCE]("{"); err == nil {
+		t.Error("parsing malformed JSON succeeded")
+	}
+}
+
+func TestCIDRBlock(t *testing.T) {
+	tests := []struct {
+		ip, mask, want string
+	}{
+		{"10.128.0.2", "255.255.240.0", "10.128.0.0/20"},
+		{"192.168.1.7", "255.255.255.255", "192.168.1.7/32"},
+		{"", "255.255.240.0", ""},
+		{"10.128.0.2", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := cidrBlock(tt.ip, tt.mask); got != tt.want {
+			t.Errorf("cidrBlock(%q, %q) = %q, want %q", tt.ip, tt.mask, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KubernetesProperties describes the pod the agent runs in.
+type KubernetesProperties struct {
+	Pod         string            `json:"pod,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// lastAppliedAnnotation holds a copy of the whole object as kubectl last
+// applied it. It's large and says nothing a layer would match on.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ParseDownwardMap parses a labels or annotations file written by the
+// downward API. Each line holds a key and a quoted value, like
+// app="web".
+func ParseDownwardMap(body []byte) (map[string]string, error) {
+	m := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: expected key=\"value\"", n)
+		}
+		value, err := strconv.Unquote(line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		m[line[:i]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	delete(m, lastAppliedAnnotation)
+
+	return m, nil
+}
+
+// ParsePod parses a pod object from the Kubernetes API into p.
+func ParsePod(body []byte, p *KubernetesProperties) error {
+	var pod struct {
+		Metadata struct {
+			Name        string            `json:"name"`
+			Namespace   string            `json:"namespace"`
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(body, &pod); err != nil {
+		return err
+	}
+
+	p.Pod = pod.Metadata.Name
+	p.Namespace = pod.Metadata.Namespace
+	p.Labels = pod.Metadata.Labels
+	p.Annotations = pod.Metadata.Annotations
+	delete(p.Annotations, lastAppliedAnnotation)
+
+	return nil
+}
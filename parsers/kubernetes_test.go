@@ -0,0 +1,75 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDownwardMap(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+		err  bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"labels", "app=\"web\"\ntier=\"frontend\"\n", map[string]string{"app": "web", "tier": "frontend"}, false},
+		{"escapes and equals signs", `note="a \"quoted\" = value"` + "\n", map[string]string{"note": `a "quoted" = value`}, false},
+		{"blank lines", "\napp=\"web\"\n\n", map[string]string{"app": "web"}, false},
+		{
+			"last applied configuration is dropped",
+			"kubectl.kubernetes.io/last-applied-configuration=\"{\\\"kind\\\":\\\"Pod\\\"}\"\nowner=\"team\"\n",
+			map[string]string{"owner": "team"},
+			false,
+		},
+		{"missing key", `="web"`, nil, true},
+		{"unquoted value", "app=web", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDownwardMap([]byte(tt.body))
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const testPod = `{
+  "kind": "Pod",
+  "metadata": {
+    "name": "web-5d8f7",
+    "namespace": "shop",
+    "labels": {"app": "web"},
+    "annotations": {
+      "kubectl.kubernetes.io/last-applied-configuration": "{\"kind\":\"Pod\"}",
+      "owner": "team"
+    }
+  },
+  "spec": {"containers": [{"name": "web"}]}
+}`
+
+func TestParsePod(t *testing.T) {
+	var p KubernetesProperties
+	if err := ParsePod([]byte(testPod), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	want := KubernetesProperties{
+		Pod:         "web-5d8f7",
+		Namespace:   "shop",
+		Labels:      map[string]string{"app": "web"},
+		Annotations: map[string]string{"owner": "team"},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+
+	if err := ParsePod([]byte("{"), &p); err == nil {
+		t.Error("ParsePod succeeded with malformed JSON")
+	}
+}
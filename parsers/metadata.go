@@ -5,17 +5,28 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
-	"time"
 	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/davepgreene/propsd-agent/utils"
 	log "github.com/sirupsen/logrus"
 )
 
+// The metadata services MetadataProperties can be read from. Every provider
+// fills in the same fields where it has an equivalent, so the account is a GCE
+// project or an Azure subscription and the tags are GCE instance attributes or
+// Azure tags. ProviderNone is used where there's no metadata service at all.
+const (
+	ProviderAWS   = "aws"
+	ProviderGCE   = "gce"
+	ProviderAzure = "azure"
+	ProviderNone  = "none"
+)
+
 type MetadataPropertiesCredentials struct {
 	LastUpdated     time.Time `json:"lastUpdated,omitempty"`
 	Type            string    `json:"type,omitempty"`
@@ -26,6 +37,12 @@ type MetadataPropertiesCredentials struct {
 	Token           string    `json:"-"`
 }
 
+// Expired reports whether the credentials have expired as of now. Credentials
+// without an expiry never do.
+func (c *MetadataPropertiesCredentials) Expired(now time.Time) bool {
+	return !c.Expiration.IsZero() && !now.Before(c.Expiration)
+}
+
 type MetadataPropertiesInterface struct {
 	VPCIPV4CIDRBlock    string `json:"vpc-ipv4-cidr-block,omitempty"`
 	SubnetIPV4CIDRBlock string `json:"subnet-ipv4-cidr-block,omitempty"`
@@ -41,15 +58,11 @@ type MetadataPropertiesIdentity struct {
 	Pkcs7    string `json:"pkcs7,omitempty"`
 }
 
-var (
-	identityMutex sync.Mutex
-	regionMutex sync.Mutex
-)
-
 type MetadataProperties struct {
 	Account          string                         `json:"account,omitempty"`
 	AmiID            string                         `json:"ami-id,omitempty"`
 	AutoScalingGroup string                         `json:"auto-scaling-group,omitempty"`
+	AutoScaling      *MetadataPropertiesAutoScaling `json:"auto-scaling,omitempty"`
 	AvailabilityZone string                         `json:"availability-zone,omitempty"`
 	Credentials      *MetadataPropertiesCredentials `json:"credentials,omitempty"`
 	Hostname         string                         `json:"hostname,omitempty"`
@@ -61,106 +74,138 @@ type MetadataProperties struct {
 	LocalHostname  string                       `json:"local-hostname,omitempty"`
 	LocalIPV4      string                       `json:"local-ipv4,omitempty"`
 	PublicHostname string                       `json:"public-hostname,omitempty"`
+	Provider       string                       `json:"provider,omitempty"`
 	PublicIPV4     string                       `json:"public-ipv4,omitempty"`
 	Region         string                       `json:"region,omitempty"`
 	ReservationID  string                       `json:"reservation-id,omitempty"`
 	SecurityGroups string                       `json:"security-groups,omitempty"`
 	VPCID          string                       `json:"vpc-id,omitempty"`
 	Tags map[string]string						`json:"tags,omitempty"`
+
+	// Notices of something about to happen to the instance.
+	SpotInstanceAction   *MetadataPropertiesSpotAction      `json:"spot-instance-action,omitempty"`
+	ScheduledEvents      []MetadataPropertiesScheduledEvent `json:"scheduled-events,omitempty"`
+	TargetLifecycleState string                             `json:"target-lifecycle-state,omitempty"`
+
+	// seen records when each field was last confirmed by its source.
+	seen map[string]time.Time
 }
 
-type MetadataParser func(string)
+// MetadataUpdate applies parsed data to a snapshot that is being assembled.
+// Updates must replace pointer and map fields rather than modifying them in
+// place, because the previous snapshot shares them and may still be in use.
+type MetadataUpdate func(*MetadataProperties)
+
+// MetadataParser parses a response body and returns the update it implies. A
+// nil update means there was nothing to apply.
+type MetadataParser func(string) (MetadataUpdate, error)
 
+// Metadata holds the current MetadataProperties snapshot. Readers get an
+// immutable snapshot without locking; writers build a copy, apply their
+// updates and swap it in, so a reader never sees a half-finished refresh.
 type Metadata struct {
-	properties *MetadataProperties
+	mu         sync.Mutex
+	properties atomic.Value
 	session    session.Session
 	Parsers    map[string]MetadataParser
 }
 
+// newMetadata returns an empty snapshot.
+func newMetadata() *Metadata {
+	m := &Metadata{}
+	m.properties.Store(&MetadataProperties{})
+
+	return m
+}
+
+// NewMetadataParser returns the parsers for the EC2 instance metadata service.
 func NewMetadataParser(session session.Session) *Metadata {
-	properties := &MetadataProperties{}
+	m := newMetadata()
+	m.session = session
+
 	c := session.ClientConfig("ec2metadata", aws.NewConfig())
 	metadataClient := utils.CreateMetadataClient(c)
-	parsers := map[string]MetadataParser{
-		"instance-identity/document": func(body string) {
+	m.Parsers = map[string]MetadataParser{
+		"instance-identity/document": func(body string) (MetadataUpdate, error) {
 			if len(body) == 0 {
-				return
-			}
-
-			// We need a lock on the struct so we don't get a data race
-			identityMutex.Lock()
-			defer identityMutex.Unlock()
-			regionMutex.Lock()
-			defer regionMutex.Unlock()
-			// Because we don't want empty marshaled structs in our JSON we make
-			// the Identity value a pointer. We don't want to create it when we
-			// instantiate an instance or else we'll get the empty object, so we
-			// need to create it whenever a parser function tries to access the
-			// Identity field.
-			if properties.Identity == nil {
-				properties.Identity = &MetadataPropertiesIdentity{}
+				return nil, nil
 			}
-			properties.Identity.Document = body
 
 			var document ec2metadata.EC2InstanceIdentityDocument
 			err := json.Unmarshal([]byte(body), &document)
 			if err != nil {
-				return
+				return nil, err
 			}
 
-			properties.Account = document.AccountID
-			properties.Region = document.Region
-			properties.AvailabilityZone = document.AvailabilityZone
-			properties.AmiID = document.ImageID
-			properties.InstanceID = document.InstanceID
-			properties.InstanceType = document.InstanceType
+			return func(p *MetadataProperties) {
+				p.setIdentity(func(i *MetadataPropertiesIdentity) { i.Document = body })
+
+				p.Provider = ProviderAWS
+				p.Account = document.AccountID
+				p.Region = document.Region
+				p.AvailabilityZone = document.AvailabilityZone
+				p.AmiID = document.ImageID
+				p.InstanceID = document.InstanceID
+				p.InstanceType = document.InstanceType
+			}, nil
 		},
-		"hostname":                func(body string) { properties.Hostname = body },
-		"local-ipv4":              func(body string) { properties.LocalIPV4 = body },
-		"local-hostname":          func(body string) { properties.LocalHostname = body },
-		"public-hostname":         func(body string) { properties.PublicHostname = body },
-		"public-ipv4":             func(body string) { properties.PublicIPV4 = body },
-		"reservation-id":          func(body string) { properties.ReservationID = body },
-		"security-groups":         func(body string) { properties.SecurityGroups = body },
-		"instance-identity/pkcs7": func(body string) {
-			// We need a lock on the struct so we don't get a data race
-			identityMutex.Lock()
-			defer identityMutex.Unlock()
-			// Because we don't want empty marshaled structs in our JSON we make
-			// the Identity value a pointer. We don't want to create it when we
-			// instantiate an instance or else we'll get the empty object, so we
-			// need to create it whenever a parser function tries to access the
-			// Identity field.
-			if properties.Identity == nil {
-				properties.Identity = &MetadataPropertiesIdentity{}
-			}
-			properties.Identity.Pkcs7 = body
+		"hostname":        stringField(func(p *MetadataProperties, v string) { p.Hostname = v }),
+		"local-ipv4":      stringField(func(p *MetadataProperties, v string) { p.LocalIPV4 = v }),
+		"local-hostname":  stringField(func(p *MetadataProperties, v string) { p.LocalHostname = v }),
+		"public-hostname": stringField(func(p *MetadataProperties, v string) { p.PublicHostname = v }),
+		"public-ipv4":     stringField(func(p *MetadataProperties, v string) { p.PublicIPV4 = v }),
+		"reservation-id":  stringField(func(p *MetadataProperties, v string) { p.ReservationID = v }),
+		"security-groups": stringField(func(p *MetadataProperties, v string) { p.SecurityGroups = v }),
+		"instance-identity/pkcs7": func(body string) (MetadataUpdate, error) {
+			return func(p *MetadataProperties) {
+				p.setIdentity(func(i *MetadataPropertiesIdentity) { i.Pkcs7 = body })
+			}, nil
 		},
-		"iam/security-credentials/": func(body string) {
+		"iam/security-credentials/": func(body string) (MetadataUpdate, error) {
 			if len(body) == 0 {
-				return
+				return nil, nil
 			}
 
-			properties.IAMRole = body
-
 			// We need to make another request to get role data
 			roleData, err := metadataClient.GetMetadata(fmt.Sprintf("iam/security-credentials/%s", body))
 			if err != nil {
-				utils.AwsServiceError(metadataClient.ServiceName, body, err)
-				return
+				return nil, err
 			}
 
-			var creds MetadataPropertiesCredentials
-			err = json.Unmarshal([]byte(roleData), &creds)
+			// The metadata service names these differently from the
+			// properties document, so they can't be decoded in place.
+			var doc struct {
+				Code            string
+				LastUpdated     time.Time
+				Type            string
+				AccessKeyId     string
+				SecretAccessKey string
+				Token           string
+				Expiration      time.Time
+			}
+			err = json.Unmarshal([]byte(roleData), &doc)
 			if err != nil {
-				return
+				return nil, err
+			}
+
+			creds := MetadataPropertiesCredentials{
+				LastUpdated:     doc.LastUpdated,
+				Type:            doc.Type,
+				AccessKeyId:     doc.AccessKeyId,
+				SecretAccessKey: doc.SecretAccessKey,
+				Expiration:      doc.Expiration,
+				Code:            doc.Code,
+				Token:           doc.Token,
 			}
 
-			properties.Credentials = &creds
+			return func(p *MetadataProperties) {
+				p.IAMRole = body
+				p.Credentials = &creds
+			}, nil
 		},
-		"network/interfaces/macs/": func(body string) {
+		"network/interfaces/macs/": func(body string) (MetadataUpdate, error) {
 			if len(body) == 0 {
-				return
+				return nil, nil
 			}
 
 			i := &MetadataPropertiesInterface{}
@@ -192,75 +237,102 @@ func NewMetadataParser(session session.Session) *Metadata {
 				}
 			}
 
-			properties.Interface = i
-			properties.VPCID = i.VPCID
+			return func(p *MetadataProperties) {
+				p.Interface = i
+				p.VPCID = i.VPCID
+			}, nil
 		},
-		"auto-scaling-group": func(body string) {
-			// We need a lock on the struct so we don't get a data race
-			regionMutex.Lock()
-			defer regionMutex.Unlock()
-
-			autoscalingClient := autoscaling.New(&session, aws.NewConfig().WithRegion(properties.Region))
-			input := &autoscaling.DescribeAutoScalingInstancesInput{
-				InstanceIds: []*string{aws.String(properties.InstanceID)},
-			}
-
-			result, err := autoscalingClient.DescribeAutoScalingInstances(input)
+		"auto-scaling-group": func(body string) (MetadataUpdate, error) {
+			// Region and instance ID come from the identity document, and the
+			// group is usually named in the tags, so read them from the
+			// current snapshot.
+			group, details, err := describeAutoScaling(&session, m.Properties())
 			if err != nil {
-				utils.AwsServiceError(autoscalingClient.ServiceName, "the autoscaling API", err)
-				return
+				return nil, err
 			}
 
-			if len(result.AutoScalingInstances) == 0 {
-				log.Debug("Empty AutoScalingInstances array")
-				return
+			if group == "" {
+				log.Debug("Instance isn't in an auto scaling group")
+				return Evict("auto-scaling-group"), nil
 			}
 
 			log.Debug("Parsed data from auto-scaling-group")
-			properties.AutoScalingGroup = *result.AutoScalingInstances[0].AutoScalingGroupName
+
+			return func(p *MetadataProperties) {
+				p.AutoScalingGroup = group
+				p.AutoScaling = details
+			}, nil
 		},
-		"tags": func(body string) {
-			// We need a lock on the struct so we don't get a data race
-			regionMutex.Lock()
-			defer regionMutex.Unlock()
-
-			ec2Client := ec2.New(&session, aws.NewConfig().WithRegion(properties.Region))
-			input := &ec2.DescribeTagsInput{
-				Filters: []*ec2.Filter{
-					{
-						Name: aws.String("resource-id"),
-						Values: []*string{aws.String(properties.InstanceID)},
-					},
-				},
+		SpotInstanceActionPath:   parseSpotInstanceAction,
+		ScheduledEventsPath:      parseScheduledEvents,
+		TargetLifecycleStatePath: stringField(func(p *MetadataProperties, v string) { p.TargetLifecycleState = strings.TrimSpace(v) }),
+		"tags": func(body string) (MetadataUpdate, error) {
+			// Reading tags from instance metadata doesn't count against the
+			// EC2 API's rate limits, so the API is only used when the
+			// instance doesn't expose its tags there.
+			tags, err := metadataTags(metadataClient)
+			if err == errMetadataTagsDisabled {
+				log.Debug("Instance metadata tags aren't enabled, using the EC2 tags API")
+				tags, err = describeTags(&session, m.Properties())
 			}
-			result, err := ec2Client.DescribeTags(input)
 			if err != nil {
-				utils.AwsServiceError(ec2Client.ServiceName, "the EC2 tags API", err)
-				return
+				return nil, err
 			}
 
-			if len(result.Tags) == 0 {
+			if len(tags) == 0 {
 				log.Debug("Empty Tags array")
-				return
-			}
-
-			tags := make(map[string]string)
-			for _, tag := range result.Tags {
-				tags[*tag.Key] = *tag.Value
+				return Evict("tags"), nil
 			}
 
 			log.Debug("Parsed data from tags")
-			properties.Tags = tags
+
+			return func(p *MetadataProperties) { p.Tags = tags }, nil
 		},
 	}
 
-	return &Metadata{
-		session:    session,
-		properties: properties,
-		Parsers:    parsers,
+	for path, parse := range m.Parsers {
+		m.Parsers[path] = tracked(path, parse)
 	}
+
+	return m
 }
 
+// Properties returns the current snapshot. It's shared with every other
+// reader and must not be modified.
 func (m *Metadata) Properties() *MetadataProperties {
-	return m.properties
-}
\ No newline at end of file
+	return m.properties.Load().(*MetadataProperties)
+}
+
+// Update copies the current snapshot, applies updates to the copy in order and
+// publishes it. Nil updates are skipped.
+func (m *Metadata) Update(updates ...MetadataUpdate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := *m.Properties()
+	for _, update := range updates {
+		if update != nil {
+			update(&next)
+		}
+	}
+	m.properties.Store(&next)
+}
+
+// identity returns a copy of the snapshot's identity so an update can change it
+// without touching the one the previous snapshot points to. Because we don't
+// want empty marshaled structs in our JSON the Identity value is a pointer that
+// stays nil until a parser has something to put in it.
+func (p *MetadataProperties) identity() *MetadataPropertiesIdentity {
+	if p.Identity == nil {
+		return &MetadataPropertiesIdentity{}
+	}
+	identity := *p.Identity
+	return &identity
+}
+
+// stringField builds a parser that stores the response body in a single field.
+func stringField(set func(*MetadataProperties, string)) MetadataParser {
+	return func(body string) (MetadataUpdate, error) {
+		return func(p *MetadataProperties) { set(p, body) }, nil
+	}
+}
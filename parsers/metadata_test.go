@@ -0,0 +1,106 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const testDocument = `{"accountId":"123","region":"us-east-1","availabilityZone":"us-east-1a","imageId":"ami-1","instanceId":"i-abc","instanceType":"t2.micro"}`
+
+func parse(t *testing.T, m *Metadata, path, body string) MetadataUpdate {
+	update, err := m.Parsers[path](body)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", path, err)
+	}
+
+	return update
+}
+
+// TestMetadataConcurrentUpdates runs refreshes against readers that marshal
+// and filter the snapshots they're given. Run it with -race.
+func TestMetadataConcurrentUpdates(t *testing.T) {
+	m := NewMetadataParser(*session.Must(session.NewSession()))
+	document := parse(t, m, "instance-identity/document", testDocument)
+	pkcs7 := parse(t, m, "instance-identity/pkcs7", "PKCS7")
+
+	const writers, readers, rounds = 4, 4, 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				hostname, err := m.Parsers["hostname"](fmt.Sprintf("host-%d-%d", w, i))
+				if err != nil {
+					t.Errorf("parsing hostname: %v", err)
+					return
+				}
+				tags := map[string]string{"writer": fmt.Sprint(w), "round": fmt.Sprint(i)}
+				m.Update(document, pkcs7, hostname, func(p *MetadataProperties) { p.Tags = tags })
+				if i%10 == 0 {
+					m.Update(Evict("instance-identity/pkcs7"), Evict("tags"))
+				}
+			}
+		}(w)
+	}
+
+	filter := FieldFilter{Include: []string{"instance-id", "hostname", "tags", "identity"}, Exclude: []string{"identity.pkcs7"}}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				p := m.Properties()
+				if _, err := json.Marshal(p); err != nil {
+					t.Errorf("marshaling snapshot: %v", err)
+					return
+				}
+				if _, err := p.Filter(filter); err != nil {
+					t.Errorf("filtering snapshot: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	p := m.Properties()
+	if p.InstanceID != "i-abc" || p.Region != "us-east-1" {
+		t.Errorf("got instance %q in %q, want i-abc in us-east-1", p.InstanceID, p.Region)
+	}
+}
+
+// TestMetadataUpdateLeavesSnapshot checks that a snapshot a reader holds
+// doesn't change when a later update is applied.
+func TestMetadataUpdateLeavesSnapshot(t *testing.T) {
+	m := NewMetadataParser(*session.Must(session.NewSession()))
+	m.Update(
+		parse(t, m, "instance-identity/document", testDocument),
+		parse(t, m, "instance-identity/pkcs7", "PKCS7"),
+		parse(t, m, "hostname", "before"),
+		func(p *MetadataProperties) { p.Tags = map[string]string{"Name": "before"} },
+	)
+	held := m.Properties()
+	before, _ := json.Marshal(held)
+
+	m.Update(
+		parse(t, m, "hostname", "after"),
+		parse(t, m, "instance-identity/pkcs7", "CHANGED"),
+		Evict("tags"),
+	)
+
+	after, _ := json.Marshal(held)
+	if string(before) != string(after) {
+		t.Errorf("held snapshot changed:\nbefore %s\nafter  %s", before, after)
+	}
+
+	p := m.Properties()
+	if p.Hostname != "after" || p.Tags != nil || p.Identity.Pkcs7 != "CHANGED" {
+		t.Errorf("got hostname %q, tags %v and pkcs7 %q, want after, none and CHANGED", p.Hostname, p.Tags, p.Identity.Pkcs7)
+	}
+}
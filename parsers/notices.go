@@ -0,0 +1,70 @@
+package parsers
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The instance metadata paths that give notice of something about to happen
+// to the instance. They're polled far more often than the rest of the
+// metadata, because a spot interruption only comes two minutes ahead.
+const (
+	SpotInstanceActionPath   = "spot/instance-action"
+	ScheduledEventsPath      = "events/maintenance/scheduled"
+	TargetLifecycleStatePath = "autoscaling/target-lifecycle-state"
+)
+
+// MetadataPropertiesSpotAction is EC2 saying it's about to stop, hibernate or
+// terminate a spot instance.
+type MetadataPropertiesSpotAction struct {
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// MetadataPropertiesScheduledEvent is maintenance EC2 has scheduled for the
+// instance. The times are given as the metadata service formats them.
+type MetadataPropertiesScheduledEvent struct {
+	EventID     string `json:"event-id"`
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state"`
+	NotBefore   string `json:"not-before,omitempty"`
+	NotAfter    string `json:"not-after,omitempty"`
+}
+
+func parseSpotInstanceAction(body string) (MetadataUpdate, error) {
+	var action MetadataPropertiesSpotAction
+	if err := json.Unmarshal([]byte(body), &action); err != nil {
+		return nil, err
+	}
+
+	return func(p *MetadataProperties) { p.SpotInstanceAction = &action }, nil
+}
+
+func parseScheduledEvents(body string) (MetadataUpdate, error) {
+	var document []struct {
+		EventID     string `json:"EventId"`
+		Code        string
+		Description string
+		State       string
+		NotBefore   string
+		NotAfter    string
+	}
+	if err := json.Unmarshal([]byte(body), &document); err != nil {
+		return nil, err
+	}
+
+	var scheduled []MetadataPropertiesScheduledEvent
+	for _, e := range document {
+		scheduled = append(scheduled, MetadataPropertiesScheduledEvent{
+			EventID:     e.EventID,
+			Code:        e.Code,
+			Description: e.Description,
+			State:       e.State,
+			NotBefore:   e.NotBefore,
+			NotAfter:    e.NotAfter,
+		})
+	}
+
+	return func(p *MetadataProperties) { p.ScheduledEvents = scheduled }, nil
+}
@@ -0,0 +1,81 @@
+package parsers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/davepgreene/propsd-agent/utils"
+)
+
+// autoScalingGroupTag is the tag EC2 puts on instances launched by an auto
+// scaling group, naming the group.
+const autoScalingGroupTag = "aws:autoscaling:groupName"
+
+// describeTagsPageSize is the most tags DescribeTags returns at once.
+const describeTagsPageSize = 1000
+
+// errMetadataTagsDisabled means the instance doesn't expose its tags in
+// instance metadata, which has to be turned on for each instance.
+var errMetadataTagsDisabled = errors.New("instance metadata tags aren't enabled")
+
+// metadataTags reads the instance's tags from instance metadata. The tag keys
+// are listed at tags/instance and each value is read from beneath it.
+func metadataTags(client *ec2metadata.EC2Metadata) (map[string]string, error) {
+	keys, err := client.GetMetadata("tags/instance")
+	if utils.IsNotFound(err) {
+		return nil, errMetadataTagsDisabled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, key := range strings.Split(keys, "\n") {
+		if key == "" {
+			continue
+		}
+		value, err := client.GetMetadata("tags/instance/" + key)
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+
+	return tags, nil
+}
+
+// describeTags reads the instance's tags from the EC2 API, a page at a time.
+func describeTags(s *session.Session, current *MetadataProperties) (map[string]string, error) {
+	ec2Client := ec2.New(s, aws.NewConfig().WithRegion(current.Region))
+	utils.RateLimited(ec2Client.Client)
+	input := &ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("resource-id"),
+				Values: []*string{aws.String(current.InstanceID)},
+			},
+			{
+				Name:   aws.String("resource-type"),
+				Values: []*string{aws.String("instance")},
+			},
+		},
+		MaxResults: aws.Int64(describeTagsPageSize),
+	}
+
+	tags := make(map[string]string)
+	err := ec2Client.DescribeTagsPages(input, func(page *ec2.DescribeTagsOutput, last bool) bool {
+		for _, tag := range page.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
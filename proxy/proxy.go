@@ -1,50 +1,82 @@
 package proxy
 
 import (
+	"bytes"
 	"net/url"
 	"net/http"
 	"time"
 	"io/ioutil"
 	"strings"
+	"fmt"
+	"sync"
 	log "github.com/sirupsen/logrus"
+	"github.com/davepgreene/propsd-agent/status"
 )
 
 const (
 	UpstreamHeader = "X-Upstream-Proxy-Invalid"
 )
 
-type Proxy struct {
+// Upstream fetches properties from the Propsd server and caches the last
+// response so it can be served when the server can't be reached.
+type Upstream struct {
+	mu sync.RWMutex
 	url string
-	handler http.Handler
 	client http.Client
 	data string
+	payload func() ([]byte, error)
+	status *status.Component
 }
 
-func New(url string, handler http.Handler) *Proxy {
+// NewUpstream returns an Upstream for url. payload builds the document sent
+// with each request.
+func NewUpstream(url string, payload func() ([]byte, error)) *Upstream {
 	client := http.Client{
 		Timeout: time.Second * 10,
 	}
 
-	return &Proxy{
+	return &Upstream{
 		url: url,
 		client: client,
-		handler: handler,
 		data: "",
+		payload: payload,
+		status: status.Register("upstream"),
 	}
 }
 
-func (p *Proxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
+// SetURL changes the upstream URL used for subsequent requests.
+func (u *Upstream) SetURL(url string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.url = url
+}
+
+// Refresh requests properties from the upstream. If the request can't be
+// built or fails, or the upstream doesn't respond with a 2xx, the cached data
+// is kept and returned along with the error.
+func (u *Upstream) Refresh() (string, error) {
+	u.mu.RLock()
+	target := u.url
+	u.mu.RUnlock()
+
+	payload, err := u.payload()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to build the document sent upstream. Falling back to cached data.")
+
+		u.status.Failure(err)
+		return u.Data(), err
+	}
 
 	// We can swallow any errors in request creation because the only ones we could generate
 	// are invalid URLs. If that's the case, we should let error handling for the http client
 	// making the request take care of any issues. That way the client (the one connecting to
 	// this agent) completes the request.
-	req, _ := http.NewRequest("GET", p.url, r.Body)
-
-	var bodyStr string
+	req, _ := http.NewRequest("GET", target, bytes.NewReader(payload))
 
-	resp, err := p.client.Do(req)
+	resp, err := u.client.Do(req)
 
 	if err != nil {
 		// We need to know what kind of error we're running into. If it's a url.Error,
@@ -60,20 +92,68 @@ func (p *Proxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			}).Warn("Error connecting to proxied target. Falling back to cached data.")
 		}
 
-		// Because the stats middleware injects its own ResponseWriter implementation, we
-		// can't just wrap http.ResponseWriter in our own implementation where we track the
-		// state of the upstream server. Instead we have to write a header to the response
-		// as a flag.
+		u.status.Failure(err)
+		return u.Data(), err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		err = fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Upstream request failed. Falling back to cached data.")
+
+		u.status.Failure(err)
+		return u.Data(), err
+	}
+	bodyStr := string(body)
+
+	u.mu.Lock()
+	u.data = bodyStr
+	u.mu.Unlock()
+
+	u.status.Success()
+
+	return bodyStr, nil
+}
+
+// Data returns the most recently fetched properties.
+func (u *Upstream) Data() string {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return u.data
+}
+
+// Proxy is middleware that replaces the request body with the cached upstream
+// properties before handing the request on.
+type Proxy struct {
+	upstream *Upstream
+	handler http.Handler
+}
+
+func New(upstream *Upstream, handler http.Handler) *Proxy {
+	return &Proxy{
+		upstream: upstream,
+		handler: handler,
+	}
+}
+
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// The upstream job refreshes the data on its own schedule, so requests
+	// are served from the cache. The header tells callers when that cache is
+	// left over from before the upstream started failing.
+	bodyStr := p.upstream.Data()
+	if p.upstream.status.Report().State != status.StateOK {
 		rw.Header().Add(UpstreamHeader, "true")
-		bodyStr = p.data
-	} else {
-		defer resp.Body.Close()
-		body, _ := ioutil.ReadAll(resp.Body)
-		bodyStr = string(body)
-		p.data = bodyStr
 	}
 
 	r.Body = ioutil.NopCloser(strings.NewReader(bodyStr))
 	r.ContentLength = int64(len(bodyStr))
 	p.handler.ServeHTTP(rw, r)
-}
\ No newline at end of file
+}
@@ -0,0 +1,232 @@
+package render
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/secrets"
+	"github.com/davepgreene/propsd-agent/serializers"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMode os.FileMode = 0644
+
+// Template is a single source template and the file it renders to.
+type Template struct {
+	Source      string
+	Destination string
+	Mode        os.FileMode
+}
+
+// ParseTemplate parses a template definition in the form
+// source:destination[:mode], where mode is an octal file mode.
+func ParseTemplate(s string) (Template, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Template{}, fmt.Errorf("invalid template %q, expected source:destination[:mode]", s)
+	}
+
+	t := Template{
+		Source:      parts[0],
+		Destination: parts[1],
+		Mode:        defaultMode,
+	}
+
+	if len(parts) == 3 {
+		mode, err := strconv.ParseUint(parts[2], 8, 32)
+		if err != nil {
+			return Template{}, fmt.Errorf("invalid mode %q for template %s: %v", parts[2], parts[0], err)
+		}
+		t.Mode = os.FileMode(mode)
+	}
+
+	return t, nil
+}
+
+// Data is the value templates are executed against.
+type Data struct {
+	Properties map[string]interface{}
+	Metadata   *parsers.MetadataProperties
+}
+
+// Renderer renders a set of templates and runs a command when any of their
+// output changes.
+type Renderer struct {
+	Templates []Template
+	Command   string
+	// Decrypter decrypts encrypted property values. Without one, rendering
+	// a template that uses an encrypted value fails.
+	Decrypter secrets.Decrypter
+}
+
+// Render executes every template against data and atomically replaces any
+// destination whose contents or mode differ. It reports whether any file was
+// written, even when a later template fails. Encrypted values are decrypted
+// here and nowhere earlier, so only the rendered files hold their plaintext.
+func (r *Renderer) Render(data Data) (bool, error) {
+	decrypter := r.Decrypter
+	var missing *placeholders
+	if decrypter == nil {
+		var err error
+		if missing, err = newPlaceholders(); err != nil {
+			return false, err
+		}
+		decrypter = missing
+	}
+
+	properties, err := secrets.Decrypt(data.Properties, decrypter)
+	if err != nil {
+		return false, err
+	}
+	data.Properties = properties
+
+	flattened := serializers.Flatten(data.Properties, serializers.FlattenOptions{
+		Separator: ".",
+		Arrays:    serializers.ArrayJoin,
+		Join:      ",",
+	})
+	funcs := template.FuncMap{
+		"property": func(key string) string { return flattened[key] },
+		"env":      os.Getenv,
+		"toJSON": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		// Missing keys are an error when accessed as fields, so default is
+		// used with index, which gives nil for a missing key.
+		"default": func(def string, v interface{}) interface{} {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+	}
+
+	changed := false
+	for _, t := range r.Templates {
+		src, err := ioutil.ReadFile(t.Source)
+		if err != nil {
+			return changed, err
+		}
+
+		tmpl, err := template.New(filepath.Base(t.Source)).Funcs(funcs).Option("missingkey=error").Parse(string(src))
+		if err != nil {
+			return changed, err
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return changed, err
+		}
+		if missing != nil && missing.used(out.Bytes()) {
+			return changed, fmt.Errorf("%s: %v", t.Source, secrets.ErrNoDecrypter)
+		}
+
+		written, err := write(t.Destination, out.Bytes(), t.Mode)
+		if err != nil {
+			return changed, err
+		}
+
+		if written {
+			log.WithFields(log.Fields{
+				"source":      t.Source,
+				"destination": t.Destination,
+			}).Info("Rendered template")
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// placeholders stands in for a decrypter when none is configured. Every
+// encrypted value becomes a random marker, so a template that uses one can be
+// told apart by its output however it read the value, while templates that
+// don't still render.
+type placeholders struct {
+	marker []byte
+}
+
+func newPlaceholders() (*placeholders, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return &placeholders{marker: []byte("propsd-encrypted-" + hex.EncodeToString(b))}, nil
+}
+
+func (p *placeholders) Decrypt(ciphertext string) (string, error) {
+	return string(p.marker), nil
+}
+
+func (p *placeholders) used(out []byte) bool {
+	return bytes.Contains(out, p.marker)
+}
+
+// Reload runs the configured command through the shell.
+func (r *Renderer) Reload() error {
+	if r.Command == "" {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"command": r.Command,
+	}).Info("Running reload command")
+
+	out, err := exec.Command("/bin/sh", "-c", r.Command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("reload command failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// write replaces path with b by writing to a temporary file in the same
+// directory and renaming it over the destination. Nothing is written if the
+// destination already has the same contents and mode.
+func write(path string, b []byte, mode os.FileMode) (bool, error) {
+	if info, err := os.Stat(path); err == nil {
+		existing, err := ioutil.ReadFile(path)
+		if err == nil && bytes.Equal(existing, b) {
+			if info.Mode().Perm() == mode {
+				return false, nil
+			}
+			return true, os.Chmod(path, mode)
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return false, err
+	}
+
+	return true, os.Rename(f.Name(), path)
+}
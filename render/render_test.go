@@ -0,0 +1,120 @@
+package render
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/davepgreene/propsd-agent/secrets"
+)
+
+func newLocal(t *testing.T) *secrets.Local {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := secrets.NewLocal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestRender(t *testing.T) {
+	l := newLocal(t)
+	ciphertext, err := l.Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := map[string]interface{}{
+		"name": "web",
+		"db": map[string]interface{}{
+			"host":     "db.local",
+			"password": map[string]interface{}{secrets.Marker: ciphertext},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		template  string
+		decrypter secrets.Decrypter
+		want      string
+		err       bool
+	}{
+		{"field", `{{ .Properties.name }}`, nil, "web", false},
+		{"property", `{{ property "db.host" }}`, nil, "db.local", false},
+		{"default for a missing key", `{{ index .Properties "port" | default "80" }}`, nil, "80", false},
+		{"missing field", `{{ .Properties.port }}`, nil, "", true},
+		{"encrypted field", `{{ .Properties.db.password }}`, l, "hunter2", false},
+		{"encrypted property", `{{ property "db.password" }}`, l, "hunter2", false},
+		{"encrypted field without a decrypter", `{{ .Properties.db.password }}`, nil, "", true},
+		{"encrypted property without a decrypter", `{{ property "db.password" }}`, nil, "", true},
+		{"encrypted value in JSON without a decrypter", `{{ toJSON .Properties.db }}`, nil, "", true},
+		{"unused encrypted value without a decrypter", `{{ .Properties.db.host }}`, nil, "db.local", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := filepath.Join(dir, "source.tmpl")
+			destination := filepath.Join(dir, "out")
+			if err := ioutil.WriteFile(source, []byte(tt.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			r := &Renderer{
+				Templates: []Template{{Source: source, Destination: destination, Mode: 0600}},
+				Decrypter: tt.decrypter,
+			}
+			changed, err := r.Render(Data{Properties: properties})
+			if (err != nil) != tt.err {
+				t.Fatalf("Render() error = %v, want error %v", err, tt.err)
+			}
+			if err != nil {
+				if changed {
+					t.Error("a failed template was reported as written")
+				}
+				if strings.Contains(err.Error(), ciphertext) {
+					t.Errorf("error %q contains the ciphertext", err)
+				}
+				return
+			}
+
+			b, err := ioutil.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("rendered %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderReportsEarlierWrites(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.tmpl")
+	bad := filepath.Join(dir, "bad.tmpl")
+	ioutil.WriteFile(good, []byte(`{{ .Properties.name }}`), 0644)
+	ioutil.WriteFile(bad, []byte(`{{ .Properties.missing }}`), 0644)
+
+	r := &Renderer{Templates: []Template{
+		{Source: good, Destination: filepath.Join(dir, "good"), Mode: 0644},
+		{Source: bad, Destination: filepath.Join(dir, "bad"), Mode: 0644},
+	}}
+	changed, err := r.Render(Data{Properties: map[string]interface{}{"name": "web"}})
+	if err == nil {
+		t.Fatal("Render succeeded with a missing key")
+	}
+	if !changed {
+		t.Error("the template written before the failure wasn't reported")
+	}
+}
@@ -0,0 +1,241 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats describes the runs of a scheduled job.
+type Stats struct {
+	LastRun      *time.Time `json:"lastRun,omitempty"`
+	LastDuration string     `json:"lastDuration,omitempty"`
+	Runs         int        `json:"runs"`
+	Skipped      int        `json:"skipped"`
+}
+
+// Scheduler runs a job on an interval until it's stopped. Runs never overlap:
+// a tick that arrives while the job is running is skipped and a RunNow call
+// queues one follow-up run, shared by every call made before it starts.
+type Scheduler struct {
+	name     string
+	fn       func()
+	interval func() time.Duration
+	jitter   float64
+
+	mu      sync.Mutex
+	running bool
+	done    chan struct{}
+	queued  chan struct{}
+	stats   Stats
+	lastRun time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]*Scheduler)
+
+	// stopping is cancelled by StopAll.
+	stopping, stopAll = context.WithCancel(context.Background())
+)
+
+// New creates a scheduler for fn and registers it under name. The interval is
+// read again before each wait so changes to it take effect without
+// restarting the scheduler. Each wait is extended by a random amount of up to
+// jitter times the interval so agents started together spread their calls
+// out.
+func New(name string, fn func(), interval func() time.Duration, jitter float64) *Scheduler {
+	s := &Scheduler{
+		name:     name,
+		fn:       fn,
+		interval: interval,
+		jitter:   jitter,
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[name] = s
+
+	return s
+}
+
+// Get returns the scheduler registered under name.
+func Get(name string) (*Scheduler, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	s, ok := registry[name]
+	return s, ok
+}
+
+// Names returns the names of every registered scheduler in sorted order.
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// StopAll stops every registered scheduler, waiting for runs in progress to
+// finish.
+func StopAll() {
+	stopAll()
+
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	for _, s := range registry {
+		s.Stop()
+	}
+}
+
+// Context returns a context that's cancelled when StopAll is called. Code that
+// starts a scheduler later, after a delay, should wait on it and pass it to
+// Start so a scheduler started during shutdown doesn't keep running.
+func Context() context.Context {
+	return stopping
+}
+
+// Start runs the job on its interval until ctx is cancelled or Stop is
+// called. The first scheduled run happens one interval after Start.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			t := time.NewTimer(s.next())
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+				// select picks at random when the context was cancelled
+				// as the timer fired, so the tick is dropped then.
+				if ctx.Err() != nil {
+					return
+				}
+				s.run(false)
+			}
+		}
+	}()
+}
+
+// Stop cancels the schedule and waits for a run in progress to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// RunNow runs the job immediately and returns once it has finished. If the
+// job is already running, that run may have started before the call, so
+// another one is queued to follow it and RunNow waits for that instead.
+func (s *Scheduler) RunNow() {
+	<-s.run(true)
+}
+
+// Stats returns a snapshot of the scheduler's run history.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	if !s.lastRun.IsZero() {
+		lastRun := s.lastRun
+		stats.LastRun = &lastRun
+	}
+
+	return stats
+}
+
+// Splay returns a random duration of up to max. Waiting that long before a
+// first run spreads out the calls agents started together would otherwise
+// make at the same moment.
+func Splay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
+
+func (s *Scheduler) next() time.Duration {
+	interval := s.interval()
+	if s.jitter <= 0 || interval <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(float64(interval)*s.jitter)+1))
+}
+
+// run starts the job unless it's already running and returns a channel
+// that's closed when the run finishes. If it's running, a scheduled run is
+// skipped and gets the current run's channel, while a queued run gets the
+// channel of the run that follows it. The follow-up runs straight after the
+// current run, on the same goroutine.
+func (s *Scheduler) run(queue bool) <-chan struct{} {
+	s.mu.Lock()
+	if s.running {
+		if !queue {
+			s.stats.Skipped++
+			done := s.done
+			s.mu.Unlock()
+			return done
+		}
+
+		if s.queued == nil {
+			s.queued = make(chan struct{})
+		}
+		queued := s.queued
+		s.mu.Unlock()
+		return queued
+	}
+
+	s.running = true
+	s.done = make(chan struct{})
+	done := s.done
+	s.mu.Unlock()
+
+	for current := done; current != nil; {
+		start := time.Now()
+		s.fn()
+
+		s.mu.Lock()
+		s.lastRun = start
+		s.stats.LastDuration = time.Since(start).String()
+		s.stats.Runs++
+		close(current)
+
+		current, s.queued = s.queued, nil
+		if current == nil {
+			s.running = false
+		} else {
+			s.done = current
+		}
+		s.mu.Unlock()
+	}
+
+	return done
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+func wait(t *testing.T, what string, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(testTimeout):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func TestRunNowQueuesAFollowUpRun(t *testing.T) {
+	var starts, finishes int32
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+
+	s := New("test-run-now", func() {
+		atomic.AddInt32(&starts, 1)
+		started <- struct{}{}
+		<-release
+		atomic.AddInt32(&finishes, 1)
+	}, func() time.Duration { return time.Hour }, 0)
+
+	go s.RunNow()
+	wait(t, "the first run", started)
+
+	// Every call must return after a run that started after it was made,
+	// which the run in progress didn't.
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			before := atomic.LoadInt32(&starts)
+			s.RunNow()
+			if n := atomic.LoadInt32(&finishes); n <= before {
+				t.Errorf("RunNow returned after %d runs, but %d had started when it was called", n, before)
+			}
+		}()
+	}
+
+	deadline := time.After(testTimeout)
+	for {
+		s.mu.Lock()
+		queued := s.queued != nil
+		s.mu.Unlock()
+		if queued {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for a follow-up run to be queued")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	// A scheduled run that finds the job running is skipped.
+	s.run(false)
+
+	close(release)
+	returned := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(returned)
+	}()
+	wait(t, "the RunNow calls to return", returned)
+
+	stats := s.Stats()
+	n := atomic.LoadInt32(&finishes)
+	if n < 2 {
+		t.Errorf("got %d runs, want a follow-up run", n)
+	}
+	if stats.Runs != int(n) {
+		t.Errorf("Stats reports %d runs, want %d", stats.Runs, n)
+	}
+	if stats.Skipped != 1 {
+		t.Errorf("got %d skipped runs, want 1", stats.Skipped)
+	}
+}
+
+func TestStartWithCancelledContext(t *testing.T) {
+	var runs int32
+	s := New("test-start-cancelled", func() {
+		atomic.AddInt32(&runs, 1)
+	}, func() time.Duration { return 0 }, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Start(ctx)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	wait(t, "the scheduler to stop", stopped)
+
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		t.Errorf("got %d runs with a cancelled context, want 0", n)
+	}
+}
+
+// StopAll cancels the package context for good, so this test runs last.
+func TestStopAllCancelsContext(t *testing.T) {
+	StopAll()
+	select {
+	case <-Context().Done():
+	default:
+		t.Fatal("Context wasn't cancelled by StopAll")
+	}
+}
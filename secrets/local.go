@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Local encrypts and decrypts values with AES-256-GCM using a key read from a
+// file. The key file holds 32 random bytes encoded as base64, which can be
+// generated with `head -c 32 /dev/urandom | base64`. Ciphertext is the
+// base64 encoding of the nonce followed by the sealed value.
+type Local struct {
+	aead cipher.AEAD
+}
+
+// NewLocal reads the key from keyFile.
+func NewLocal(keyFile string) (*Local, error) {
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't a base64 encoded key: %v", keyFile, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s must hold a 32 byte key, got %d bytes", keyFile, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{aead: aead}, nil
+}
+
+// Encrypt implements Encrypter.
+func (l *Local) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := l.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt implements Decrypter.
+func (l *Local) Decrypt(ciphertext string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.New("ciphertext isn't base64 encoded")
+	}
+	if len(b) < l.aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	nonce, sealed := b[:l.aead.NonceSize()], b[l.aead.NonceSize():]
+	plaintext, err := l.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("ciphertext doesn't match the key")
+	}
+
+	return string(plaintext), nil
+}
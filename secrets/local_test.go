@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newKeyFile writes a random key in the format NewLocal reads.
+func newKeyFile(t *testing.T) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newLocal(t *testing.T) *Local {
+	l, err := NewLocal(newKeyFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return l
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	l := newLocal(t)
+
+	for _, plaintext := range []string{"hunter2", "", "ünïcödé", strings.Repeat("x", 4096)} {
+		ciphertext, err := l.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && strings.Contains(ciphertext, plaintext) {
+			t.Errorf("ciphertext %q contains the plaintext", ciphertext)
+		}
+
+		got, err := l.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatalf("decrypting %q: %v", ciphertext, err)
+		}
+		if got != plaintext {
+			t.Errorf("round trip gave %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestLocalEncryptUsesFreshNonces(t *testing.T) {
+	l := newLocal(t)
+
+	a, _ := l.Encrypt("same")
+	b, _ := l.Encrypt("same")
+	if a == b {
+		t.Error("encrypting the same value twice gave the same ciphertext")
+	}
+}
+
+func TestLocalDecryptFailures(t *testing.T) {
+	l := newLocal(t)
+	ciphertext, err := l.Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, _ := base64.StdEncoding.DecodeString(ciphertext)
+	sealed[len(sealed)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(sealed)
+
+	tests := []struct {
+		name       string
+		decrypter  *Local
+		ciphertext string
+	}{
+		{"wrong key", newLocal(t), ciphertext},
+		{"tampered", l, tampered},
+		{"not base64", l, "not base64!"},
+		{"too short", l, base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.decrypter.Decrypt(tt.ciphertext)
+			if err == nil {
+				t.Fatalf("Decrypt succeeded with %q", got)
+			}
+			if got != "" || strings.Contains(err.Error(), "hunter2") {
+				t.Errorf("failed decryption leaked the plaintext: %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestNewLocalRejectsBadKeys(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"not base64": "not a key!",
+		"too short":  base64.StdEncoding.EncodeToString(make([]byte, 16)),
+	}
+
+	for name, contents := range tests {
+		path := filepath.Join(dir, strings.Replace(name, " ", "-", -1))
+		if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewLocal(path); err == nil {
+			t.Errorf("%s: NewLocal succeeded", name)
+		}
+	}
+
+	if _, err := NewLocal(filepath.Join(dir, "missing")); err == nil {
+		t.Error("NewLocal succeeded with a missing key file")
+	}
+}
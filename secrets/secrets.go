@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Marker is the key of an encrypted property value. An encrypted value is an
+// object holding only the marker and the ciphertext, like
+// {"$encrypted": "..."}.
+const Marker = "$encrypted"
+
+// Redacted replaces encrypted values anywhere they'd otherwise be printed.
+const Redacted = "REDACTED"
+
+// ErrNoDecrypter is returned when properties hold encrypted values but no
+// secrets provider is configured.
+var ErrNoDecrypter = errors.New("properties contain encrypted values but no secrets provider is configured")
+
+// Decrypter turns the ciphertext of an encrypted value back into plaintext.
+type Decrypter interface {
+	Decrypt(ciphertext string) (string, error)
+}
+
+// Encrypter is implemented by providers that can also produce ciphertext.
+// Providers backed by an external key service may leave encryption to that
+// service's own tooling.
+type Encrypter interface {
+	Encrypt(plaintext string) (string, error)
+}
+
+// Ciphertext returns the ciphertext of v if it's an encrypted value.
+func Ciphertext(v interface{}) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+
+	ciphertext, ok := m[Marker].(string)
+	return ciphertext, ok
+}
+
+// Decrypt returns a copy of data with every encrypted value replaced by its
+// plaintext. data itself is left alone so the ciphertext is all that's kept
+// around. Errors name the property but never its value.
+func Decrypt(data map[string]interface{}, d Decrypter) (map[string]interface{}, error) {
+	v, err := decrypt("", data, d)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(map[string]interface{}), nil
+}
+
+func decrypt(path string, v interface{}, d Decrypter) (interface{}, error) {
+	if ciphertext, ok := Ciphertext(v); ok {
+		if d == nil {
+			return nil, ErrNoDecrypter
+		}
+		plaintext, err := d.Decrypt(ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decrypt %s: %v", path, err)
+		}
+		return plaintext, nil
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			value, err := decrypt(childPath, child, d)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = value
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, child := range t {
+			value, err := decrypt(fmt.Sprintf("%s[%d]", path, i), child, d)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = value
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecrypt(t *testing.T) {
+	l := newLocal(t)
+	password, _ := l.Encrypt("hunter2")
+	token, _ := l.Encrypt("t0ken")
+
+	data := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user":     "app",
+			"password": map[string]interface{}{Marker: password},
+		},
+		"tokens": []interface{}{map[string]interface{}{Marker: token}, "plain"},
+		// Objects with more than the marker aren't encrypted values.
+		"other": map[string]interface{}{Marker: "x", "note": "kept"},
+	}
+
+	got, err := Decrypt(data, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"db": map[string]interface{}{
+			"user":     "app",
+			"password": "hunter2",
+		},
+		"tokens": []interface{}{"t0ken", "plain"},
+		"other":  map[string]interface{}{Marker: "x", "note": "kept"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decrypt() = %v, want %v", got, want)
+	}
+
+	if _, ok := Ciphertext(data["db"].(map[string]interface{})["password"]); !ok {
+		t.Error("Decrypt modified the document it was given")
+	}
+}
+
+func TestDecryptWithoutDecrypter(t *testing.T) {
+	data := map[string]interface{}{"password": map[string]interface{}{Marker: "abc"}}
+
+	if _, err := Decrypt(data, nil); err != ErrNoDecrypter {
+		t.Errorf("got %v, want %v", err, ErrNoDecrypter)
+	}
+}
+
+func TestDecryptErrorNamesTheProperty(t *testing.T) {
+	ciphertext, _ := newLocal(t).Encrypt("hunter2")
+	data := map[string]interface{}{
+		"db": map[string]interface{}{"password": map[string]interface{}{Marker: ciphertext}},
+	}
+
+	_, err := Decrypt(data, newLocal(t))
+	if err == nil {
+		t.Fatal("Decrypt succeeded with the wrong key")
+	}
+	if !strings.Contains(err.Error(), "db.password") {
+		t.Errorf("error %q doesn't name the property", err)
+	}
+	if strings.Contains(err.Error(), ciphertext) {
+		t.Errorf("error %q contains the value", err)
+	}
+}
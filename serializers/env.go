@@ -0,0 +1,113 @@
+package serializers
+
+import (
+	"bytes"
+	"strings"
+)
+
+// EnvOptions configures how flattened keys become environment variable names.
+type EnvOptions struct {
+	// Prefix is prepended to every variable name.
+	Prefix string
+	// Case is applied to names: "upper" (the default), "lower" or "preserve".
+	Case string
+	// Replacement stands in for each run of characters that aren't valid in
+	// a variable name. It defaults to an underscore.
+	Replacement string
+}
+
+// EnvName converts a flattened key into an environment variable name. Every
+// run of characters outside [A-Za-z0-9_] is replaced and a leading digit is
+// prefixed with an underscore.
+func EnvName(key string, o EnvOptions) string {
+	replacement := o.Replacement
+	if replacement == "" {
+		replacement = "_"
+	}
+
+	name := o.Prefix + key
+	switch o.Case {
+	case "lower":
+		name = strings.ToLower(name)
+	case "preserve":
+	default:
+		name = strings.ToUpper(name)
+	}
+
+	var b strings.Builder
+	replaced := false
+	for _, r := range name {
+		if (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+			replaced = false
+			continue
+		}
+		if !replaced {
+			b.WriteString(replacement)
+			replaced = true
+		}
+	}
+
+	// Only a trailing replacement is trimmed, not an underscore that was in
+	// the key, so foo_ and foo. stay different names.
+	name = b.String()
+	if replaced {
+		name = strings.TrimSuffix(name, replacement)
+	}
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// EnvVars returns a flattened document as NAME=value pairs in the form used
+// by os/exec.
+func EnvVars(flattened map[string]string, o EnvOptions) []string {
+	vars := make([]string, 0, len(flattened))
+	for _, k := range Keys(flattened) {
+		if name := EnvName(k, o); name != "" {
+			vars = append(vars, name+"="+flattened[k])
+		}
+	}
+
+	return vars
+}
+
+// Env writes a flattened document as KEY=value lines. With export set every
+// line is an `export` statement that can be sourced by a POSIX shell;
+// otherwise the lines use dotenv quoting.
+func Env(flattened map[string]string, o EnvOptions, export bool) []byte {
+	var b bytes.Buffer
+
+	for _, k := range Keys(flattened) {
+		name := EnvName(k, o)
+		if name == "" {
+			continue
+		}
+
+		if export {
+			b.WriteString("export ")
+			b.WriteString(name)
+			b.WriteString("='")
+			b.WriteString(strings.Replace(flattened[k], "'", `'\''`, -1))
+			b.WriteString("'\n")
+			continue
+		}
+
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(dotenvReplacer.Replace(flattened[k]))
+		b.WriteString("\"\n")
+	}
+
+	return b.Bytes()
+}
+
+var dotenvReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"\n", `\n`,
+	"\r", `\r`,
+)
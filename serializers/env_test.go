@@ -0,0 +1,31 @@
+package serializers
+
+import "testing"
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		key     string
+		options EnvOptions
+		want    string
+	}{
+		{"db.host", EnvOptions{}, "DB_HOST"},
+		{"db.host", EnvOptions{Case: "lower"}, "db_host"},
+		{"db.Host", EnvOptions{Case: "preserve"}, "db_Host"},
+		{"db.host", EnvOptions{Prefix: "app."}, "APP_DB_HOST"},
+		{"servers[0].host", EnvOptions{}, "SERVERS_0_HOST"},
+		{"a-b..c", EnvOptions{}, "A_B_C"},
+		{"db.host", EnvOptions{Replacement: "__"}, "DB__HOST"},
+		{"1st", EnvOptions{}, "_1ST"},
+		{"foo.", EnvOptions{}, "FOO"},
+		{"foo_", EnvOptions{}, "FOO_"},
+		{"foo_.", EnvOptions{}, "FOO_"},
+		{"foo.", EnvOptions{Replacement: "__"}, "FOO"},
+		{"...", EnvOptions{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := EnvName(tt.key, tt.options); got != tt.want {
+			t.Errorf("EnvName(%q, %+v) = %q, want %q", tt.key, tt.options, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package serializers
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davepgreene/propsd-agent/secrets"
+)
+
+// ArrayStyle controls how arrays are represented in a flattened document.
+type ArrayStyle string
+
+const (
+	// ArrayJoin joins arrays of scalar values into a single delimited value.
+	// Arrays containing objects or other arrays fall back to ArrayIndex.
+	ArrayJoin ArrayStyle = "join"
+	// ArrayIndex emits one key per element, suffixed with its index.
+	ArrayIndex ArrayStyle = "index"
+)
+
+// FlattenOptions configures Flatten.
+type FlattenOptions struct {
+	// Separator is placed between the keys of nested objects.
+	Separator string
+	// Arrays selects how arrays are flattened.
+	Arrays ArrayStyle
+	// Join is placed between array elements when Arrays is ArrayJoin.
+	Join string
+	// Include limits the output to these top-level keys. An empty list
+	// includes every key.
+	Include []string
+	// Exclude removes these top-level keys from the output.
+	Exclude []string
+}
+
+// DefaultFlattenOptions matches the historic behavior of the conqueso endpoint.
+var DefaultFlattenOptions = FlattenOptions{
+	Separator: ".",
+	Arrays:    ArrayJoin,
+	Join:      ",",
+	Exclude:   []string{"instance", "tags"},
+}
+
+// Decode parses a JSON document, preserving numbers as json.Number so
+// integers aren't reformatted as floats when they're serialized again.
+func Decode(b []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Flatten collapses a decoded JSON document into a single level map of
+// string values.
+func Flatten(data map[string]interface{}, o FlattenOptions) map[string]string {
+	flattened := make(map[string]string)
+
+	include := make(map[string]bool, len(o.Include))
+	for _, k := range o.Include {
+		include[k] = true
+	}
+	exclude := make(map[string]bool, len(o.Exclude))
+	for _, k := range o.Exclude {
+		exclude[k] = true
+	}
+
+	for k, v := range data {
+		if exclude[k] || (len(include) > 0 && !include[k]) {
+			continue
+		}
+		flatten(flattened, k, v, o)
+	}
+
+	return flattened
+}
+
+// Keys returns the keys of a flattened document in sorted order.
+func Keys(flattened map[string]string) []string {
+	keys := make([]string, 0, len(flattened))
+	for k := range flattened {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func flatten(flattened map[string]string, prefix string, v interface{}, o FlattenOptions) {
+	// Encrypted values are only decrypted when they're rendered, so anything
+	// flattened before then shows them redacted.
+	if _, ok := secrets.Ciphertext(v); ok {
+		flattened[prefix] = secrets.Redacted
+		return
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			flatten(flattened, prefix+o.Separator+k, child, o)
+		}
+	case []interface{}:
+		// An empty array keeps its key in every mode, so it can be told
+		// apart from a missing one.
+		if len(t) == 0 {
+			flattened[prefix] = ""
+			return
+		}
+		if o.Arrays == ArrayJoin && scalars(t) {
+			values := make([]string, len(t))
+			for i, child := range t {
+				values[i] = Scalar(child)
+			}
+			flattened[prefix] = strings.Join(values, o.Join)
+			return
+		}
+
+		for i, child := range t {
+			flatten(flattened, prefix+"["+strconv.Itoa(i)+"]", child, o)
+		}
+	default:
+		flattened[prefix] = Scalar(t)
+	}
+}
+
+func scalars(values []interface{}) bool {
+	for _, v := range values {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Scalar formats a decoded JSON scalar as a string. Null becomes an empty
+// string.
+func Scalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
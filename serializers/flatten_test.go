@@ -0,0 +1,165 @@
+package serializers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlatten(t *testing.T) {
+	dotted := FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: ","}
+	indexed := FlattenOptions{Separator: ".", Arrays: ArrayIndex}
+
+	tests := []struct {
+		name     string
+		document string
+		options  FlattenOptions
+		want     map[string]string
+	}{
+		{
+			name:     "nested objects",
+			document: `{"db":{"host":"db.local","port":5432,"tls":{"enabled":true}}}`,
+			options:  dotted,
+			want: map[string]string{
+				"db.host":        "db.local",
+				"db.port":        "5432",
+				"db.tls.enabled": "true",
+			},
+		},
+		{
+			name:     "custom separator",
+			document: `{"db":{"host":"db.local","pool":{"max":10}}}`,
+			options:  FlattenOptions{Separator: "_", Arrays: ArrayJoin, Join: ","},
+			want: map[string]string{
+				"db_host":     "db.local",
+				"db_pool_max": "10",
+			},
+		},
+		{
+			name:     "scalars",
+			document: `{"s":"text","i":12345678901234567890,"f":1.5,"b":false,"n":null}`,
+			options:  dotted,
+			want: map[string]string{
+				"s": "text",
+				"i": "12345678901234567890",
+				"f": "1.5",
+				"b": "false",
+				"n": "",
+			},
+		},
+		{
+			name:     "joined array",
+			document: `{"hosts":["a","b","c"],"ports":[80,443],"empty":[]}`,
+			options:  dotted,
+			want: map[string]string{
+				"hosts": "a,b,c",
+				"ports": "80,443",
+				"empty": "",
+			},
+		},
+		{
+			name:     "joined array with custom join",
+			document: `{"hosts":["a","b"]}`,
+			options:  FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: "|"},
+			want: map[string]string{
+				"hosts": "a|b",
+			},
+		},
+		{
+			name:     "joined array of objects falls back to indexes",
+			document: `{"backends":[{"host":"a"},{"host":"b"}]}`,
+			options:  dotted,
+			want: map[string]string{
+				"backends[0].host": "a",
+				"backends[1].host": "b",
+			},
+		},
+		{
+			name:     "joined array of arrays falls back to indexes",
+			document: `{"grid":[[1,2],[3]]}`,
+			options:  dotted,
+			want: map[string]string{
+				"grid[0]": "1,2",
+				"grid[1]": "3",
+			},
+		},
+		{
+			name:     "indexed array",
+			document: `{"hosts":["a","b"]}`,
+			options:  indexed,
+			want: map[string]string{
+				"hosts[0]": "a",
+				"hosts[1]": "b",
+			},
+		},
+		{
+			name:     "empty arrays keep their key when joined",
+			document: `{"empty":[],"nested":{"empty":[]},"grid":[[]]}`,
+			options:  dotted,
+			want: map[string]string{
+				"empty":        "",
+				"nested.empty": "",
+				"grid[0]":      "",
+			},
+		},
+		{
+			name:     "empty arrays keep their key when indexed",
+			document: `{"empty":[],"nested":{"empty":[]},"grid":[[]]}`,
+			options:  indexed,
+			want: map[string]string{
+				"empty":        "",
+				"nested.empty": "",
+				"grid[0]":      "",
+			},
+		},
+		{
+			name:     "indexed nested arrays and objects",
+			document: `{"grid":[[1,2],[{"x":3}]]}`,
+			options:  indexed,
+			want: map[string]string{
+				"grid[0][0]":   "1",
+				"grid[0][1]":   "2",
+				"grid[1][0].x": "3",
+			},
+		},
+		{
+			name:     "keys containing the separator are kept as they are",
+			document: `{"db.host":"a","db":{"port":1,"pool.max":2}}`,
+			options:  dotted,
+			want: map[string]string{
+				"db.host":     "a",
+				"db.port":     "1",
+				"db.pool.max": "2",
+			},
+		},
+		{
+			name:     "keys containing a custom separator",
+			document: `{"a_b":{"c_d":"x"}}`,
+			options:  FlattenOptions{Separator: "_", Arrays: ArrayJoin, Join: ","},
+			want: map[string]string{
+				"a_b_c_d": "x",
+			},
+		},
+		{
+			name:     "include and exclude",
+			document: `{"app":{"name":"web"},"instance":{"id":"i-1"},"tags":{"team":"core"}}`,
+			options:  FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: ",", Include: []string{"app", "tags"}, Exclude: []string{"tags"}},
+			want: map[string]string{
+				"app.name": "web",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Decode([]byte(tt.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := Flatten(data, tt.options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
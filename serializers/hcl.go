@@ -0,0 +1,87 @@
+package serializers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// marshalHCL writes a document as HCL. Objects become blocks, arrays become
+// lists and nulls are dropped because HCL has no null literal.
+func marshalHCL(data map[string]interface{}) []byte {
+	var b bytes.Buffer
+	writeHCLObject(&b, normalize(data, true).(map[string]interface{}), 0)
+
+	return b.Bytes()
+}
+
+func writeHCLObject(b *bytes.Buffer, m map[string]interface{}, depth int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	indent := strings.Repeat("  ", depth)
+	for _, k := range keys {
+		b.WriteString(indent)
+		b.WriteString(hclKey(k))
+
+		if child, ok := m[k].(map[string]interface{}); ok {
+			b.WriteString(" {\n")
+			writeHCLObject(b, child, depth+1)
+			b.WriteString(indent)
+			b.WriteString("}\n")
+			continue
+		}
+
+		b.WriteString(" = ")
+		writeHCLValue(b, m[k], depth)
+		b.WriteByte('\n')
+	}
+}
+
+func writeHCLValue(b *bytes.Buffer, v interface{}, depth int) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		b.WriteString("{\n")
+		writeHCLObject(b, t, depth+1)
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		first := true
+		for _, child := range t {
+			if child == nil {
+				continue
+			}
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			writeHCLValue(b, child, depth)
+		}
+		b.WriteByte(']')
+	case string:
+		b.WriteString(strconv.Quote(t))
+	default:
+		fmt.Fprint(b, t)
+	}
+}
+
+func hclKey(k string) string {
+	for i, r := range k {
+		identifier := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(i > 0 && (r == '-' || r == '.' || (r >= '0' && r <= '9')))
+		if !identifier {
+			return strconv.Quote(k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+
+	return k
+}
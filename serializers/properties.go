@@ -0,0 +1,80 @@
+package serializers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character encoding a properties file is written for.
+type Encoding string
+
+const (
+	// UTF8 writes non-ASCII characters as-is.
+	UTF8 Encoding = "utf8"
+	// ISO88591 escapes every non-ASCII character as \uXXXX, which is what
+	// java.util.Properties.load(InputStream) expects.
+	ISO88591 Encoding = "iso-8859-1"
+)
+
+// PropertiesOptions configures Properties.
+type PropertiesOptions struct {
+	Encoding Encoding
+}
+
+// Properties writes a flattened document in the Java .properties format with
+// keys in sorted order.
+func Properties(flattened map[string]string, o PropertiesOptions) []byte {
+	var b bytes.Buffer
+
+	for _, k := range Keys(flattened) {
+		b.WriteString(escapeProperty(k, true, o.Encoding))
+		b.WriteByte('=')
+		b.WriteString(escapeProperty(flattened[k], false, o.Encoding))
+		b.WriteByte('\n')
+	}
+
+	return b.Bytes()
+}
+
+func escapeProperty(s string, key bool, enc Encoding) string {
+	var b strings.Builder
+
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!':
+			if key {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		case ' ':
+			// Leading whitespace in a value is dropped by the parser and any
+			// whitespace in a key terminates it.
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			if r < 0x20 || (enc == ISO88591 && r > 0x7e) {
+				for _, c := range utf16.Encode([]rune{r}) {
+					fmt.Fprintf(&b, `\u%04x`, c)
+				}
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
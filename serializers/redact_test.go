@@ -0,0 +1,100 @@
+package serializers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davepgreene/propsd-agent/secrets"
+)
+
+const ciphertext = "c2VhbGVkIHNlY3JldA=="
+
+const encrypted = `{
+	"db": {"host": "db.local", "password": {"$encrypted": "` + ciphertext + `"}},
+	"tokens": [{"$encrypted": "` + ciphertext + `"}, "plain"]
+}`
+
+func TestFlattenRedactsEncryptedValues(t *testing.T) {
+	data, err := Decode([]byte(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options FlattenOptions
+		want    map[string]string
+	}{
+		{
+			name:    "joined",
+			options: FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: ","},
+			want: map[string]string{
+				"db.host":     "db.local",
+				"db.password": secrets.Redacted,
+				"tokens[0]":   secrets.Redacted,
+				"tokens[1]":   "plain",
+			},
+		},
+		{
+			name:    "indexed",
+			options: FlattenOptions{Separator: ".", Arrays: ArrayIndex},
+			want: map[string]string{
+				"db.host":     "db.local",
+				"db.password": secrets.Redacted,
+				"tokens[0]":   secrets.Redacted,
+				"tokens[1]":   "plain",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Flatten(data, tt.options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flatten() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRedactsEncryptedValues(t *testing.T) {
+	data, err := Decode([]byte(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"db":     map[string]interface{}{"host": "db.local", "password": secrets.Redacted},
+		"tokens": []interface{}{secrets.Redacted, "plain"},
+	}
+	if got := normalize(data, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("normalize() = %v, want %v", got, want)
+	}
+
+	if _, ok := secrets.Ciphertext(data["db"].(map[string]interface{})["password"]); !ok {
+		t.Error("normalize modified the document it was given")
+	}
+}
+
+func TestSerializeRedactsEncryptedValues(t *testing.T) {
+	data, err := Decode([]byte(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Flatten: FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: ","}}
+
+	for _, f := range []Format{FlatJSON, Java, YAML, TOML, HCL, Dotenv, Shell} {
+		t.Run(string(f), func(t *testing.T) {
+			out, err := Serialize(data, f, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), ciphertext) {
+				t.Errorf("output contains the ciphertext:\n%s", out)
+			}
+			if !strings.Contains(string(out), secrets.Redacted) {
+				t.Errorf("output doesn't mark the value as redacted:\n%s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package serializers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davepgreene/propsd-agent/secrets"
+)
+
+// Format identifies an output format for a properties document.
+type Format string
+
+const (
+	JSON     Format = "json"
+	FlatJSON Format = "flat"
+	Java     Format = "properties"
+	YAML     Format = "yaml"
+	TOML     Format = "toml"
+	HCL      Format = "hcl"
+	Dotenv   Format = "dotenv"
+	Shell    Format = "shell"
+)
+
+// Options holds the settings shared by the formats that need them.
+type Options struct {
+	Flatten    FlattenOptions
+	Properties PropertiesOptions
+	Env        EnvOptions
+}
+
+var contentTypes = map[Format]string{
+	JSON:     "application/json",
+	FlatJSON: "application/json",
+	Java:     "text/plain",
+	YAML:     "application/x-yaml",
+	TOML:     "application/toml",
+	HCL:      "application/hcl",
+	Dotenv:   "text/plain",
+	Shell:    "text/plain",
+}
+
+// mediaTypes maps the media types accepted in an Accept header to formats.
+// text/plain is too generic to pick a format by, so it only matches a default
+// that's served as text/plain.
+var mediaTypes = map[string]Format{
+	"application/json":       JSON,
+	"text/x-java-properties": Java,
+	"application/x-yaml":     YAML,
+	"application/yaml":       YAML,
+	"text/yaml":              YAML,
+	"application/toml":       TOML,
+	"application/x-toml":     TOML,
+	"application/hcl":        HCL,
+	"text/x-hcl":             HCL,
+	"text/x-shellscript":     Shell,
+	"application/x-sh":       Shell,
+}
+
+// ContentType returns the media type a serialized document should be served as.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (Format, error) {
+	f := Format(strings.ToLower(name))
+	if _, ok := contentTypes[f]; !ok {
+		return "", fmt.Errorf("unknown format %q", name)
+	}
+
+	return f, nil
+}
+
+// Negotiate picks a format from an explicit format name, falling back to the
+// Accept header and then to def. ok is false when the Accept header doesn't
+// name any supported format, in which case f is def.
+func Negotiate(name string, accept string, def Format) (f Format, ok bool, err error) {
+	if name != "" {
+		f, err = ParseFormat(name)
+		return f, err == nil, err
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return def, true, nil
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	for _, c := range candidates {
+		// The default wins over other formats that share its media type so
+		// text/plain still means .properties on the conqueso endpoint.
+		if def.ContentType() == c.mediaType {
+			return def, true, nil
+		}
+		if f, ok := mediaTypes[c.mediaType]; ok {
+			return f, true, nil
+		}
+		if c.mediaType == "*/*" || c.mediaType == strings.SplitN(def.ContentType(), "/", 2)[0]+"/*" {
+			return def, true, nil
+		}
+	}
+
+	return def, false, nil
+}
+
+// Serialize converts a decoded JSON document into the given format.
+func Serialize(data map[string]interface{}, f Format, o Options) ([]byte, error) {
+	switch f {
+	case JSON:
+		return json.Marshal(data)
+	case FlatJSON:
+		return json.Marshal(Flatten(data, o.Flatten))
+	case Java:
+		return Properties(Flatten(data, o.Flatten), o.Properties), nil
+	case YAML:
+		return marshalYAML(data)
+	case TOML:
+		return marshalTOML(data)
+	case HCL:
+		return marshalHCL(data), nil
+	case Dotenv:
+		return Env(Flatten(data, o.Flatten), o.Env, false), nil
+	case Shell:
+		return Env(Flatten(data, o.Flatten), o.Env, true), nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", f)
+}
+
+// normalize converts json.Number values into int64, uint64 or float64 so
+// encoders that don't know about json.Number write them as numbers. Integers
+// that don't fit in 64 bits are written as strings rather than rounded. Nulls are dropped
+// from objects when dropNulls is set, for formats that can't represent them.
+// Encrypted values are redacted, as they are when flattened.
+func normalize(v interface{}, dropNulls bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, child := range t {
+			if child == nil && dropNulls {
+				continue
+			}
+			m[k] = normalizeValue(child, dropNulls)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, child := range t {
+			a[i] = normalizeValue(child, dropNulls)
+		}
+		return a
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(t.String(), 10, 64); err == nil {
+			return u
+		}
+		// An integer too big for 64 bits would be rounded as a float, so
+		// it's kept as it was written instead.
+		if strings.ContainsAny(t.String(), ".eE") {
+			if f, err := t.Float64(); err == nil {
+				return f
+			}
+		}
+		return t.String()
+	default:
+		return t
+	}
+}
+
+// normalizeValue normalizes a value inside an object or array, which is where
+// encrypted values can appear.
+func normalizeValue(v interface{}, dropNulls bool) interface{} {
+	if _, ok := secrets.Ciphertext(v); ok {
+		return secrets.Redacted
+	}
+
+	return normalize(v, dropNulls)
+}
@@ -0,0 +1,186 @@
+package serializers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		accept string
+		def    Format
+		want   Format
+		ok     bool
+		err    bool
+	}{
+		{"no preference", "", "", JSON, JSON, true, false},
+		{"format parameter", "yaml", "", JSON, YAML, true, false},
+		{"format parameter beats Accept", "toml", "application/x-yaml", JSON, TOML, true, false},
+		{"format parameter is case insensitive", "HCL", "", JSON, HCL, true, false},
+		{"unknown format parameter", "xml", "application/json", JSON, "", false, true},
+		{"Accept", "", "application/x-yaml", JSON, YAML, true, false},
+		{"Accept with parameters", "", "application/toml; charset=utf-8", JSON, TOML, true, false},
+		{"highest q wins", "", "application/x-yaml;q=0.5, application/toml;q=0.9", JSON, TOML, true, false},
+		{"order breaks q ties", "", "application/toml, application/x-yaml", JSON, TOML, true, false},
+		{"missing q means 1", "", "application/x-yaml;q=0.9, application/hcl", JSON, HCL, true, false},
+		{"q of 0 excludes", "", "application/x-yaml;q=0, application/json;q=0.1", Java, JSON, true, false},
+		{"unsupported types are skipped", "", "application/xml, application/x-yaml;q=0.1", JSON, YAML, true, false},
+		{"wildcard", "", "*/*", Java, Java, true, false},
+		{"type wildcard", "", "text/*", Java, Java, true, false},
+		{"type wildcard for another type", "", "text/*", JSON, JSON, false, false},
+		{"default wins on its media type", "", "application/json", FlatJSON, FlatJSON, true, false},
+		{"text/plain is the default's", "", "text/plain", Java, Java, true, false},
+		{"text/plain names no other format", "", "text/plain", JSON, JSON, false, false},
+		{"nothing matches", "", "application/xml, image/png", JSON, JSON, false, false},
+		{"malformed entries are skipped", "", "/;;, application/x-yaml", JSON, YAML, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := Negotiate(tt.format, tt.accept, tt.def)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Negotiate(%q, %q, %s) = %s, %v, want %s, %v", tt.format, tt.accept, tt.def, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name      string
+		number    string
+		dropNulls bool
+		want      interface{}
+	}{
+		{"int64", "42", false, int64(42)},
+		{"negative int64", "-9223372036854775808", false, int64(-9223372036854775808)},
+		{"uint64", "18446744073709551615", false, uint64(18446744073709551615)},
+		{"beyond 64 bits", "18446744073709551616", false, "18446744073709551616"},
+		{"negative beyond 64 bits", "-9223372036854775809", false, "-9223372036854775809"},
+		{"float", "0.5", false, 0.5},
+		{"exponent", "1e3", false, 1000.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalize(json.Number(tt.number), tt.dropNulls)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalize(%s) = %#v, want %#v", tt.number, got, tt.want)
+			}
+		})
+	}
+
+	data, err := Decode([]byte(`{"a":null,"b":{"c":null,"d":[1,null]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"b": map[string]interface{}{"d": []interface{}{int64(1), nil}},
+	}
+	if got := normalize(data, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("normalize() dropping nulls = %#v, want %#v", got, want)
+	}
+}
+
+const document = `{"app":{"name":"web","port":8080,"big":12345678901234567890,"huge":123456789012345678901234567890,"ratio":0.5,"on":true,"none":null,"tags":["a","b"],"quote":"it's \"x\" $HOME"}}`
+
+func TestSerialize(t *testing.T) {
+	data, err := Decode([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := Options{Flatten: FlattenOptions{Separator: ".", Arrays: ArrayJoin, Join: ","}}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{YAML, `app:
+  big: 12345678901234567890
+  huge: "123456789012345678901234567890"
+  name: web
+  none: null
+  "on": true
+  port: 8080
+  quote: it's "x" $HOME
+  ratio: 0.5
+  tags:
+  - a
+  - b
+`},
+		{TOML, `
+[app]
+  big = 12345678901234567890
+  huge = "123456789012345678901234567890"
+  name = "web"
+  on = true
+  port = 8080
+  quote = "it's \"x\" $HOME"
+  ratio = 0.5
+  tags = ["a","b"]
+`},
+		{HCL, `app {
+  big = 12345678901234567890
+  huge = "123456789012345678901234567890"
+  name = "web"
+  on = true
+  port = 8080
+  quote = "it's \"x\" $HOME"
+  ratio = 0.5
+  tags = ["a", "b"]
+}
+`},
+		{Dotenv, `APP_BIG="12345678901234567890"
+APP_HUGE="123456789012345678901234567890"
+APP_NAME="web"
+APP_NONE=""
+APP_ON="true"
+APP_PORT="8080"
+APP_QUOTE="it's \"x\" \$HOME"
+APP_RATIO="0.5"
+APP_TAGS="a,b"
+`},
+		{Shell, `export APP_BIG='12345678901234567890'
+export APP_HUGE='123456789012345678901234567890'
+export APP_NAME='web'
+export APP_NONE=''
+export APP_ON='true'
+export APP_PORT='8080'
+export APP_QUOTE='it'\''s "x" $HOME'
+export APP_RATIO='0.5'
+export APP_TAGS='a,b'
+`},
+		{Java, `app.big=12345678901234567890
+app.huge=123456789012345678901234567890
+app.name=web
+app.none=
+app.on=true
+app.port=8080
+app.quote=it's "x" $HOME
+app.ratio=0.5
+app.tags=a,b
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got, err := Serialize(data, tt.format, o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Serialize(data, Format("xml"), o); err == nil {
+		t.Error("Serialize succeeded with an unknown format")
+	}
+}
@@ -0,0 +1,62 @@
+package serializers
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pelletier/go-toml"
+)
+
+func marshalTOML(data map[string]interface{}) ([]byte, error) {
+	normalized := normalize(data, true).(map[string]interface{})
+	if err := validateTOML("", normalized); err != nil {
+		return nil, err
+	}
+
+	tree, err := toml.TreeFromMap(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := tree.ToTomlString()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+// validateTOML rejects documents TOML can't represent: arrays must either
+// hold tables or scalars of a single type, and can't contain nulls.
+func validateTOML(path string, v interface{}) error {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if err := validateTOML(path+"."+k, child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		var kind reflect.Type
+		for _, child := range t {
+			if child == nil {
+				return fmt.Errorf("%s: TOML arrays can't contain null", path[1:])
+			}
+			if _, ok := child.([]interface{}); ok {
+				return fmt.Errorf("%s: nested arrays aren't supported in TOML output", path[1:])
+			}
+			if kind != nil && reflect.TypeOf(child) != kind {
+				return fmt.Errorf("%s: TOML arrays must contain values of a single type", path[1:])
+			}
+			kind = reflect.TypeOf(child)
+
+			if m, ok := child.(map[string]interface{}); ok {
+				if err := validateTOML(path, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+package serializers
+
+import (
+	"gopkg.in/yaml.v2"
+)
+
+func marshalYAML(data map[string]interface{}) ([]byte, error) {
+	return yaml.Marshal(normalize(data, false))
+}
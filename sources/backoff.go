@@ -0,0 +1,41 @@
+package sources
+
+import (
+	"sync"
+	"time"
+)
+
+// backoff stretches the interval of a job whose API is throttling it. Each
+// throttled run in a row doubles the wait, up to a limit, and the first run
+// that isn't throttled goes back to the usual interval.
+type backoff struct {
+	mu        sync.Mutex
+	throttled uint
+}
+
+func (b *backoff) record(throttled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if throttled {
+		b.throttled++
+	} else {
+		b.throttled = 0
+	}
+}
+
+// interval returns base stretched for the throttled runs so far, but never
+// more than max.
+func (b *backoff) interval(base, max time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wait := base
+	for i := uint(0); i < b.throttled && wait < max; i++ {
+		wait *= 2
+	}
+	if b.throttled > 0 && wait > max {
+		wait = max
+	}
+	return wait
+}
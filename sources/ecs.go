@@ -0,0 +1,134 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
+	log "github.com/sirupsen/logrus"
+)
+
+// ECSMetadataEnv is set by the ECS agent in every container to the base URL of
+// the task metadata endpoint.
+const ECSMetadataEnv = "ECS_CONTAINER_METADATA_URI_V4"
+
+// ecsTimeout bounds each request to the task metadata endpoint, which is
+// served by the local ECS agent and should answer quickly.
+const ecsTimeout = 5 * time.Second
+
+// ECS reads the task metadata endpoint of the ECS task the agent runs in.
+type ECS struct {
+	uri        string
+	client     http.Client
+	properties atomic.Value
+	status     *status.Component
+}
+
+// ECSMetadataURI returns the configured task metadata endpoint, falling back
+// to the one the ECS agent provides. It's empty outside of ECS.
+func ECSMetadataURI(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return os.Getenv(ECSMetadataEnv)
+}
+
+func NewECSSource(uri string) *ECS {
+	e := &ECS{
+		uri: strings.TrimSuffix(uri, "/"),
+		// The task metadata endpoint is link local, so proxy settings
+		// from the environment are ignored.
+		client: http.Client{
+			Timeout:   ecsTimeout,
+			Transport: &http.Transport{},
+		},
+		status: status.Register("ecs"),
+	}
+	e.properties.Store(&parsers.ECSProperties{})
+
+	return e
+}
+
+// Get refreshes the task and container metadata. Both are fetched before
+// anything is published so readers never see half of a refresh.
+func (e *ECS) Get() {
+	p := &parsers.ECSProperties{}
+
+	// taskWithTags needs the task role to allow ecs:ListTagsForResource and
+	// isn't served by older ECS agents, which only have /task.
+	body, err := e.fetch("/taskWithTags")
+	if err == errECSNotFound {
+		body, err = e.fetch("/task")
+	}
+	if err == nil {
+		err = parsers.ParseECSTask(body, p)
+	}
+	if err == nil {
+		body, err = e.fetch("")
+	}
+	if err == nil {
+		err = parsers.ParseECSContainer(body, p)
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Unable to read ECS task metadata")
+		e.status.Failure(err)
+		return
+	}
+
+	log.Debug("Parsed data from ECS task metadata")
+	e.properties.Store(p)
+	e.status.Success()
+}
+
+// Properties returns the current task metadata, which must not be modified.
+func (e *ECS) Properties() *parsers.ECSProperties {
+	return e.properties.Load().(*parsers.ECSProperties)
+}
+
+// Key implements Section.
+func (e *ECS) Key() string {
+	return "ecs"
+}
+
+// Value implements Section. It's nil until the task metadata has been read.
+func (e *ECS) Value() interface{} {
+	p := e.Properties()
+	if p.TaskARN == "" {
+		return nil
+	}
+	return p
+}
+
+var errECSNotFound = errors.New("task metadata endpoint returned 404")
+
+func (e *ECS) fetch(path string) ([]byte, error) {
+	resp, err := e.client.Get(e.uri + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errECSNotFound
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("task metadata endpoint returned %d for %s", resp.StatusCode, e.uri+path)
+	}
+
+	return body, nil
+}
@@ -0,0 +1,215 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
+	log "github.com/sirupsen/logrus"
+)
+
+// Environment describes where the agent runs, which decides the sources it
+// reads. Empty values mean the agent isn't running there.
+type Environment struct {
+	// Provider is the metadata provider, which is parsers.ProviderNone off
+	// cloud.
+	Provider string
+	// ECS is the task metadata endpoint.
+	ECS string
+	// Kubernetes is where pod metadata is read from, "downward" or "api".
+	Kubernetes string
+	// Probed is set when the provider was decided by probing the metadata
+	// services rather than by the settings or the machine's DMI data.
+	Probed bool
+}
+
+// detectTimeout bounds each probe of a metadata service. Services that are
+// there answer in milliseconds, so this only delays startup off cloud.
+var detectTimeout = 2 * time.Second
+
+// probeRetryMin and probeRetryMax bound the wait between the probes
+// AwaitMetadataProvider repeats.
+var probeRetryMin, probeRetryMax = 10 * time.Second, 5 * time.Minute
+
+// dmiDir holds the firmware's description of the machine, which names the
+// cloud on every provider we support.
+const dmiDir = "/sys/class/dmi/id"
+
+// DetectEnvironment works out where the agent runs from c, the process
+// environment and the machine it's on. A configured metadata provider is
+// trusted; otherwise the machine's DMI data is checked first and the metadata
+// services are only probed if that's inconclusive.
+func DetectEnvironment(c *config.Config) Environment {
+	env := Environment{
+		Provider:   c.Metadata.Provider,
+		ECS:        ECSMetadataURI(c.ECS.URI),
+		Kubernetes: KubernetesMode(c.Kubernetes.Source, c.Kubernetes.Path),
+	}
+
+	if env.Provider == "" {
+		env.Provider = DetectMetadataProvider()
+	}
+	if env.Provider == "" {
+		env.Provider = probeMetadataProviders(c.Metadata)
+		env.Probed = true
+	}
+
+	return env
+}
+
+// AwaitMetadataProvider probes the metadata services again until one answers
+// and then passes its provider to found. A metadata service that's slow or
+// unreachable while the machine boots looks the same as none at all, so a
+// probe that found nothing isn't trusted for good. The wait between probes
+// doubles after each miss, up to probeRetryMax. It gives up when ctx is
+// cancelled.
+func AwaitMetadataProvider(ctx context.Context, c func() config.MetadataConfig, found func(provider string)) {
+	wait := probeRetryMin
+	for {
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		provider := probeMetadataProviders(c())
+		if ctx.Err() != nil {
+			return
+		}
+		if provider != parsers.ProviderNone {
+			log.WithField("provider", provider).Info("Found a metadata service")
+			found(provider)
+			return
+		}
+
+		wait *= 2
+		if wait > probeRetryMax {
+			wait = probeRetryMax
+		}
+	}
+}
+
+// DetectMetadataProvider returns the cloud the machine's DMI data names, or ""
+// if it doesn't name one.
+func DetectMetadataProvider() string {
+	vendor := dmi("sys_vendor")
+	switch {
+	case vendor == "Google" || strings.HasPrefix(dmi("product_name"), "Google Compute Engine"):
+		return parsers.ProviderGCE
+	// Azure VMs carry a fixed asset tag that sets them apart from other
+	// Hyper-V guests.
+	case vendor == "Microsoft Corporation" && dmi("chassis_asset_tag") == "7783-7084-3265-9085":
+		return parsers.ProviderAzure
+	// Nitro instances name themselves; older Xen instances only mention
+	// Amazon in their BIOS version and hypervisor UUID.
+	case vendor == "Amazon EC2" || strings.Contains(dmi("bios_version"), "amazon"):
+		return parsers.ProviderAWS
+	}
+
+	if uuid, err := ioutil.ReadFile("/sys/hypervisor/uuid"); err == nil && strings.HasPrefix(string(uuid), "ec2") {
+		return parsers.ProviderAWS
+	}
+
+	return ""
+}
+
+func dmi(name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dmiDir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// probeMetadataProviders asks each metadata service whether it's there, all at
+// once, and returns the first in order of preference that answered. The EC2
+// and Azure services share an address, so each answer is checked for
+// something only the real service would send.
+func probeMetadataProviders(c config.MetadataConfig) string {
+	probes := []struct {
+		provider string
+		url      string
+		header   http.Header
+		ok       func(*http.Response) bool
+	}{
+		{
+			parsers.ProviderGCE,
+			strings.TrimSuffix(c.GCE.Host, "/") + "/computeMetadata/v1/",
+			http.Header{"Metadata-Flavor": {"Google"}},
+			func(r *http.Response) bool { return r.Header.Get("Metadata-Flavor") == "Google" },
+		},
+		{
+			parsers.ProviderAzure,
+			fmt.Sprintf("%s/metadata/instance?api-version=%s", strings.TrimSuffix(c.Azure.Host, "/"), c.Azure.Version),
+			http.Header{"Metadata": {"true"}},
+			func(r *http.Response) bool { return r.StatusCode == http.StatusOK },
+		},
+		{
+			parsers.ProviderAWS,
+			fmt.Sprintf("%s/%s/meta-data/", strings.TrimSuffix(c.Host, "/"), c.Version),
+			nil,
+			// Instances that require IMDSv2 refuse requests without a token.
+			func(r *http.Response) bool {
+				return r.StatusCode == http.StatusOK || r.StatusCode == http.StatusUnauthorized
+			},
+		},
+	}
+
+	client := http.Client{
+		Timeout:   detectTimeout,
+		Transport: &http.Transport{},
+	}
+	found := make([]bool, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, url string, header http.Header, ok func(*http.Response) bool) {
+			defer wg.Done()
+
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				return
+			}
+			for key, values := range header {
+				req.Header[key] = values
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+					"url":   url,
+				}).Debug("Metadata service probe failed")
+				return
+			}
+			resp.Body.Close()
+			found[i] = ok(resp)
+		}(i, p.url, p.header, p.ok)
+	}
+	wg.Wait()
+
+	for i, p := range probes {
+		if found[i] {
+			return p.provider
+		}
+	}
+
+	return parsers.ProviderNone
+}
+
+// Disable records that a source doesn't apply where the agent runs, so it
+// isn't read at all. It's logged once and shows up in the status report
+// instead of as a stream of errors.
+func Disable(name, reason string) {
+	log.WithField("reason", reason).Infof("Disabling %s", name)
+	status.Register(name).Disable(reason)
+}
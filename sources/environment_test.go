@@ -0,0 +1,114 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/parsers"
+)
+
+// hang answers nothing until the client gives up on the request.
+func hang(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
+func shortProbes(t *testing.T) {
+	timeout, min, max := detectTimeout, probeRetryMin, probeRetryMax
+	detectTimeout, probeRetryMin, probeRetryMax = 50*time.Millisecond, 10*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() {
+		detectTimeout, probeRetryMin, probeRetryMax = timeout, min, max
+	})
+}
+
+func probeConfig(host, aws string) config.MetadataConfig {
+	return config.MetadataConfig{
+		Host:    aws,
+		Version: "latest",
+		GCE:     config.GCEConfig{Host: host},
+		Azure:   config.AzureConfig{Host: host, Version: "2021-02-01"},
+	}
+}
+
+func TestProbeTimesOut(t *testing.T) {
+	shortProbes(t)
+	slow := httptest.NewServer(http.HandlerFunc(hang))
+	defer slow.Close()
+
+	start := time.Now()
+	if got := probeMetadataProviders(probeConfig(slow.URL, slow.URL)); got != parsers.ProviderNone {
+		t.Errorf("got provider %q, want %q", got, parsers.ProviderNone)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("probes took %s with a %s timeout", elapsed, detectTimeout)
+	}
+}
+
+func TestAwaitMetadataProviderAfterTimeouts(t *testing.T) {
+	shortProbes(t)
+	slow := httptest.NewServer(http.HandlerFunc(hang))
+	defer slow.Close()
+
+	// The EC2 metadata service times out twice before it comes up.
+	var probes int32
+	ec2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&probes, 1) <= 2 {
+			hang(w, r)
+			return
+		}
+		w.Write([]byte("instance-id\n"))
+	}))
+	defer ec2.Close()
+
+	c := probeConfig(slow.URL, ec2.URL)
+	if got := probeMetadataProviders(c); got != parsers.ProviderNone {
+		t.Fatalf("first probe found %q", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	found := make(chan string, 1)
+	go AwaitMetadataProvider(ctx, func() config.MetadataConfig { return c }, func(provider string) {
+		found <- provider
+	})
+
+	select {
+	case provider := <-found:
+		if provider != parsers.ProviderAWS {
+			t.Errorf("found %q, want %q", provider, parsers.ProviderAWS)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the metadata service wasn't found once it answered")
+	}
+	if n := atomic.LoadInt32(&probes); n != 3 {
+		t.Errorf("the EC2 service was probed %d times, want 3", n)
+	}
+}
+
+func TestAwaitMetadataProviderStops(t *testing.T) {
+	shortProbes(t)
+	slow := httptest.NewServer(http.HandlerFunc(hang))
+	defer slow.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		AwaitMetadataProvider(ctx, func() config.MetadataConfig {
+			return probeConfig(slow.URL, slow.URL)
+		}, func(provider string) {
+			t.Errorf("found %q with no metadata service", provider)
+		})
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AwaitMetadataProvider didn't return once cancelled")
+	}
+}
@@ -0,0 +1,259 @@
+package sources
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
+	log "github.com/sirupsen/logrus"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account
+// token, CA certificate and namespace.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubernetesTimeout bounds each request to the Kubernetes API.
+const kubernetesTimeout = 5 * time.Second
+
+// Kubernetes reads the pod the agent runs in, either from files written by the
+// downward API or from the Kubernetes API.
+type Kubernetes struct {
+	mode       string
+	path       string
+	apiURL     string
+	client     http.Client
+	properties atomic.Value
+	status     *status.Component
+}
+
+// KubernetesMode resolves the configured source to "downward" or "api". Left
+// empty it picks the downward API when path exists and the Kubernetes API when
+// running in a cluster. It returns "" outside of Kubernetes.
+func KubernetesMode(configured, path string) string {
+	switch configured {
+	case "downward", "api":
+		return configured
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "downward"
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "api"
+	}
+
+	return ""
+}
+
+// NewKubernetesSource returns a source for mode. The downward API files are
+// read from path, which may hold name, namespace, labels and annotations files.
+func NewKubernetesSource(mode, path string) (*Kubernetes, error) {
+	k := &Kubernetes{
+		mode:   mode,
+		path:   path,
+		status: status.Register("kubernetes"),
+	}
+	k.properties.Store(&parsers.KubernetesProperties{})
+
+	if mode == "api" {
+		if err := k.connectAPI(); err != nil {
+			k.status.Failure(err)
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// connectAPI sets up the client for the Kubernetes API from the service
+// account mounted into the pod.
+func (k *Kubernetes) connectAPI() error {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return errors.New("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set to use the Kubernetes API")
+	}
+	k.apiURL = "https://" + net.JoinHostPort(host, port)
+
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return errors.New("no certificates found in the service account CA")
+	}
+	k.client = http.Client{
+		Timeout:   kubernetesTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	return nil
+}
+
+// Get refreshes the pod's name, namespace, labels and annotations.
+func (k *Kubernetes) Get() {
+	var p *parsers.KubernetesProperties
+	var err error
+	if k.mode == "api" {
+		p, err = k.fromAPI()
+	} else {
+		p, err = k.fromDownwardAPI()
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"source": k.mode,
+		}).Error("Unable to read Kubernetes pod metadata")
+		k.status.Failure(err)
+		return
+	}
+
+	log.Debugf("Parsed data from the Kubernetes %s", k.mode)
+	k.properties.Store(p)
+	k.status.Success()
+}
+
+// Properties returns the current pod metadata, which must not be modified.
+func (k *Kubernetes) Properties() *parsers.KubernetesProperties {
+	return k.properties.Load().(*parsers.KubernetesProperties)
+}
+
+// Key implements Section.
+func (k *Kubernetes) Key() string {
+	return "kubernetes"
+}
+
+// Value implements Section. It's nil until the pod has been read.
+func (k *Kubernetes) Value() interface{} {
+	p := k.Properties()
+	if p.Pod == "" {
+		return nil
+	}
+	return p
+}
+
+func (k *Kubernetes) fromDownwardAPI() (*parsers.KubernetesProperties, error) {
+	p := &parsers.KubernetesProperties{}
+
+	name, err := readOptional(filepath.Join(k.path, "name"))
+	if err != nil {
+		return nil, err
+	}
+	p.Pod = firstOf(name, os.Getenv("POD_NAME"), hostname())
+
+	namespace, err := readOptional(filepath.Join(k.path, "namespace"))
+	if err != nil {
+		return nil, err
+	}
+	p.Namespace = firstOf(namespace, os.Getenv("POD_NAMESPACE"), serviceAccountNamespace())
+
+	for file, field := range map[string]*map[string]string{
+		"labels":      &p.Labels,
+		"annotations": &p.Annotations,
+	} {
+		body, err := readOptional(filepath.Join(k.path, file))
+		if err != nil {
+			return nil, err
+		}
+		if body == "" {
+			continue
+		}
+		if *field, err = parsers.ParseDownwardMap([]byte(body)); err != nil {
+			return nil, fmt.Errorf("%s: %v", filepath.Join(k.path, file), err)
+		}
+	}
+
+	return p, nil
+}
+
+func (k *Kubernetes) fromAPI() (*parsers.KubernetesProperties, error) {
+	name := firstOf(os.Getenv("POD_NAME"), hostname())
+	namespace := firstOf(os.Getenv("POD_NAMESPACE"), serviceAccountNamespace())
+	if name == "" || namespace == "" {
+		return nil, errors.New("unable to determine the pod name and namespace")
+	}
+
+	// Service account tokens are rotated, so the current one is read for
+	// every request.
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s", k.apiURL, namespace, name)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kubernetes API returned %d for pod %s/%s", resp.StatusCode, namespace, name)
+	}
+
+	p := &parsers.KubernetesProperties{}
+	if err := parsers.ParsePod(body, p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// readOptional returns the trimmed contents of file, or "" if it doesn't
+// exist.
+func readOptional(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+func serviceAccountNamespace() string {
+	namespace, _ := readOptional(filepath.Join(serviceAccountDir, "namespace"))
+	return namespace
+}
+
+// hostname returns the pod's hostname, which is its name unless the pod spec
+// overrides it.
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
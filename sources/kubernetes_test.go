@@ -0,0 +1,169 @@
+package sources
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestKubernetesDownwardAPI(t *testing.T) {
+	t.Setenv("POD_NAME", "from-env")
+	t.Setenv("POD_NAMESPACE", "env-namespace")
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  *parsers.KubernetesProperties
+	}{
+		{
+			"all files",
+			map[string]string{
+				"name":        "web-5d8f7\n",
+				"namespace":   "shop\n",
+				"labels":      "app=\"web\"\ntier=\"frontend\"\n",
+				"annotations": "kubectl.kubernetes.io/last-applied-configuration=\"{\\\"kind\\\":\\\"Pod\\\"}\"\nowner=\"team\"\n",
+			},
+			&parsers.KubernetesProperties{
+				Pod:         "web-5d8f7",
+				Namespace:   "shop",
+				Labels:      map[string]string{"app": "web", "tier": "frontend"},
+				Annotations: map[string]string{"owner": "team"},
+			},
+		},
+		{
+			"name and namespace from the environment",
+			map[string]string{"labels": "app=\"web\"\n"},
+			&parsers.KubernetesProperties{
+				Pod:       "from-env",
+				Namespace: "env-namespace",
+				Labels:    map[string]string{"app": "web"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			k, err := NewKubernetesSource("downward", dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k.Get()
+
+			if got := k.Properties(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if r := k.status.Report(); r.State != status.StateOK {
+				t.Errorf("got state %s, want %s", r.State, status.StateOK)
+			}
+		})
+	}
+}
+
+func TestKubernetesDownwardAPIMalformed(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"name": "web", "labels": "app=web\n"})
+
+	k, err := NewKubernetesSource("downward", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Get()
+
+	if k.Value() != nil {
+		t.Errorf("got %+v from a malformed labels file", k.Value())
+	}
+	if r := k.status.Report(); r.State == status.StateOK {
+		t.Error("a malformed labels file was reported as ok")
+	}
+}
+
+const testPod = `{
+  "kind": "Pod",
+  "metadata": {
+    "name": "web-5d8f7",
+    "namespace": "shop",
+    "labels": {"app": "web"},
+    "annotations": {
+      "kubectl.kubernetes.io/last-applied-configuration": "{\"kind\":\"Pod\"}",
+      "owner": "team"
+    }
+  }
+}`
+
+func TestKubernetesAPI(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer pod-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/namespaces/shop/pods/web-5d8f7" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testPod))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	writeFiles(t, dir, map[string]string{"ca.crt": string(ca), "token": "pod-token\n", "namespace": "shop"})
+	defer func(d string) { serviceAccountDir = d }(serviceAccountDir)
+	serviceAccountDir = dir
+
+	u, _ := url.Parse(server.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+	t.Setenv("POD_NAME", "web-5d8f7")
+	t.Setenv("POD_NAMESPACE", "")
+
+	k, err := NewKubernetesSource("api", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Get()
+
+	want := &parsers.KubernetesProperties{
+		Pod:         "web-5d8f7",
+		Namespace:   "shop",
+		Labels:      map[string]string{"app": "web"},
+		Annotations: map[string]string{"owner": "team"},
+	}
+	if got := k.Properties(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if r := k.status.Report(); r.State != status.StateOK {
+		t.Errorf("got state %s, want %s", r.State, status.StateOK)
+	}
+
+	// A rejected token leaves the last pod in place.
+	writeFiles(t, dir, map[string]string{"token": "revoked"})
+	k.Get()
+	if got := k.Properties(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v after a failed refresh, want %+v", got, want)
+	}
+	if r := k.status.Report(); r.State == status.StateOK {
+		t.Error("a rejected token was reported as ok")
+	}
+}
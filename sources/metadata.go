@@ -5,17 +5,25 @@ import (
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
 	log "github.com/sirupsen/logrus"
+	"github.com/davepgreene/propsd-agent/config"
+	"github.com/davepgreene/propsd-agent/events"
 	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
 	"github.com/davepgreene/propsd-agent/utils"
 	"encoding/json"
+	"errors"
+	"time"
 )
 
 type MetadataOptions struct {
 }
 
 type MetadataChannelResponse struct {
-	Path string
-	Body string
+	Path   string
+	Body   string
+	Update parsers.MetadataUpdate
+	// Missing is set when the metadata service says the path doesn't exist.
+	Missing bool
 }
 
 type MetadataChannelErrorResponse struct {
@@ -23,9 +31,28 @@ type MetadataChannelErrorResponse struct {
 	Error error
 }
 
+const credentialsPath = "iam/security-credentials/"
+
+// credentialsRetry is the shortest wait between credential refreshes.
+const credentialsRetry = 10 * time.Second
+
+var (
+	errNoInstanceProfile  = errors.New("no instance profile is attached")
+	errCredentialsExpired = errors.New("instance profile credentials have expired")
+)
+
 type Metadata struct {
 	client *ec2metadata.EC2Metadata
 	parser *parsers.Metadata
+
+	metadataStatus    *status.Component
+	credentialsStatus *status.Component
+	tagsStatus        *status.Component
+	asgStatus         *status.Component
+	noticesStatus     *status.Component
+
+	tagsBackoff backoff
+	asgBackoff  backoff
 }
 
 func NewMetadataSource(session session.Session) *Metadata {
@@ -35,9 +62,19 @@ func NewMetadataSource(session session.Session) *Metadata {
 	return &Metadata{
 		client: utils.CreateMetadataClient(c),
 		parser: parsers.NewMetadataParser(session),
+
+		metadataStatus:    status.Register("metadata"),
+		credentialsStatus: status.Register("credentials"),
+		tagsStatus:        status.Register("tags"),
+		asgStatus:         status.Register("asg"),
+		noticesStatus:     status.Register("notices"),
 	}
 }
 
+func (m *Metadata) Name() string {
+	return parsers.ProviderAWS
+}
+
 func (m *Metadata) Get() {
 	resc, errc := make(chan MetadataChannelResponse), make(chan MetadataChannelErrorResponse)
 	paths := map[string]func(string) (string, error){
@@ -50,38 +87,219 @@ func (m *Metadata) Get() {
 		"reservation-id":             m.client.GetMetadata,
 		"security-groups":            m.client.GetMetadata,
 		"instance-identity/pkcs7":    m.client.GetDynamicData,
-		"iam/security-credentials/":   m.client.GetMetadata,
-		"network/interfaces/macs/":    m.client.GetMetadata,
+		"network/interfaces/macs/":   m.client.GetMetadata,
 	}
 
 	for path, fn := range paths {
 		go m.fetch(resc, errc, path, fn, m.parser.Parsers[path])
 	}
 
+	// Credentials are left to Credentials, which refreshes them on their own
+	// schedule and tracks them separately so a missing instance profile
+	// doesn't mark the rest of the metadata as unhealthy.
+	var lastErr error
+	failed, throttled := 0, 0
+	updates := make([]parsers.MetadataUpdate, 0, len(paths))
 	for i := 0; i < len(paths); i++ {
 		select {
 		case res := <-resc:
+			updates = append(updates, res.Update)
+			if res.Missing {
+				log.Debugf("%s is no longer present in instance metadata, clearing it", res.Path)
+				continue
+			}
 			log.Debugf("Parsed data from %s", res.Path)
 		case err := <-errc:
-			utils.AwsServiceError(m.client.ServiceName, err.Path, err.Error)
+			isThrottled := utils.AwsServiceError(m.client.ServiceName, err.Path, err.Error)
+			lastErr = err.Error
+			failed++
+			if isThrottled {
+				throttled++
+			}
 		}
 	}
 
-	// We can use goroutines for all the other metadata but because ASG relies on instance region and ID we
-	// have to wait until those are complete.
-	m.AutoScaling()
+	// Everything fetched in this pass is published as a single snapshot.
+	m.parser.Update(updates...)
+
+	switch {
+	case failed == 0:
+		m.metadataStatus.Success()
+	case throttled == failed:
+		m.metadataStatus.Throttled(lastErr)
+	case failed == len(paths):
+		m.metadataStatus.Failure(lastErr)
+	default:
+		m.metadataStatus.Degraded(lastErr)
+	}
+}
+
+// Credentials refreshes only the instance profile credentials.
+func (m *Metadata) Credentials() {
+	resc, errc := make(chan MetadataChannelResponse, 1), make(chan MetadataChannelErrorResponse, 1)
+	m.fetch(resc, errc, credentialsPath, m.client.GetMetadata, m.parser.Parsers[credentialsPath])
+
+	select {
+	case res := <-resc:
+		m.parser.Update(res.Update)
+		if res.Missing {
+			log.Debugf("%s is no longer present in instance metadata, clearing it", res.Path)
+			m.recordCredentials(errNoInstanceProfile)
+			return
+		}
+		m.recordCredentials(nil)
+	case err := <-errc:
+		utils.AwsServiceError(m.client.ServiceName, err.Path, err.Error)
+		m.recordCredentials(err.Error)
+	}
+}
+
+// CredentialsRefresh returns how long to wait before refreshing the
+// credentials so they're replaced margin before they expire. Without an
+// expiry to go by it returns fallback.
+func (m *Metadata) CredentialsRefresh(margin, fallback time.Duration) time.Duration {
+	creds := m.Properties().Credentials
+	if creds == nil || creds.Expiration.IsZero() {
+		return fallback
+	}
+
+	// Inside the margin the metadata service may not have rotated the
+	// credentials yet, so keep checking without hammering it.
+	wait := time.Until(creds.Expiration.Add(-margin))
+	if wait < credentialsRetry {
+		return credentialsRetry
+	}
+	return wait
+}
+
+// CredentialsExpired reports whether the credentials in p have already
+// expired. Anything using them will be rejected by AWS, so this logs a warning
+// and records the credentials as unhealthy the first time it's noticed. Expired
+// credentials aren't a successful refresh, so the status keeps its last success.
+func (m *Metadata) CredentialsExpired(p *parsers.MetadataProperties) bool {
+	if p.Credentials == nil || !p.Credentials.Expired(time.Now()) {
+		return false
+	}
+
+	r := m.credentialsStatus.Report()
+	if r.State == status.StateOK || r.LastError != errCredentialsExpired.Error() {
+		log.WithField("expires", p.Credentials.Expiration).Warn("Serving instance profile credentials that have already expired")
+		m.credentialsStatus.Failure(errCredentialsExpired)
+	}
+	return true
+}
+
+// recordCredentials updates the credentials status after a fetch. A fetch that
+// handed back expired credentials doesn't count as a success.
+func (m *Metadata) recordCredentials(err error) {
+	if utils.IsThrottled(err) {
+		m.credentialsStatus.Throttled(err)
+		return
+	}
+	if err != nil {
+		m.credentialsStatus.Failure(err)
+		return
+	}
+	if m.CredentialsExpired(m.Properties()) {
+		return
+	}
+	m.credentialsStatus.Success()
 }
 
 func (m *Metadata) Tags() {
-	m.parser.Parsers["tags"]("")
+	update, err := m.parser.Parsers["tags"]("")
+	if err != nil {
+		throttled := utils.AwsServiceError("ec2", "the EC2 tags API", err)
+		m.tagsBackoff.record(throttled)
+		if throttled {
+			m.tagsStatus.Throttled(err)
+			return
+		}
+		m.tagsStatus.Failure(err)
+		return
+	}
+	m.tagsBackoff.record(false)
+	m.parser.Update(update)
+	m.tagsStatus.Success()
+}
+
+// TagsInterval returns how long to wait before reading the tags again, which
+// is interval unless the EC2 API has been throttling us.
+func (m *Metadata) TagsInterval(interval, max time.Duration) time.Duration {
+	return m.tagsBackoff.interval(interval, max)
 }
 
 func (m *Metadata) AutoScaling() {
-	m.parser.Parsers["auto-scaling-group"]("")
+	update, err := m.parser.Parsers["auto-scaling-group"]("")
+	if err != nil {
+		throttled := utils.AwsServiceError("autoscaling", "the autoscaling API", err)
+		m.asgBackoff.record(throttled)
+		if throttled {
+			m.asgStatus.Throttled(err)
+			return
+		}
+		m.asgStatus.Failure(err)
+		return
+	}
+	m.asgBackoff.record(false)
+
+	before := m.Properties().AutoScaling
+	m.parser.Update(update)
+	// The first lookup only finds out where the instance is, it isn't a
+	// change.
+	if config.Current().ASG.Events && m.asgStatus.Report().LastSuccess != nil {
+		publishLifecycleChange(before, m.Properties())
+	}
+	m.asgStatus.Success()
 }
 
-func (m *Metadata) fetch(resc chan MetadataChannelResponse, errc chan MetadataChannelErrorResponse, path string, method func(string) (string, error), parser func(string)) {
+// publishLifecycleChange publishes an event if the instance's lifecycle state
+// in its auto scaling group differs from before. Joining or leaving a group
+// counts as a change from or to no state.
+func publishLifecycleChange(before *parsers.MetadataPropertiesAutoScaling, p *parsers.MetadataProperties) {
+	var from, to string
+	if before != nil {
+		from = before.LifecycleState
+	}
+	if p.AutoScaling != nil {
+		to = p.AutoScaling.LifecycleState
+	}
+	if from == to {
+		return
+	}
+
+	events.Publish("asg-lifecycle", map[string]string{
+		"instance-id":        p.InstanceID,
+		"auto-scaling-group": p.AutoScalingGroup,
+		"from":               from,
+		"to":                 to,
+	})
+}
+
+// AutoScalingInterval returns how long to wait before looking up the auto
+// scaling group again, which is interval unless the autoscaling API has been
+// throttling us.
+func (m *Metadata) AutoScalingInterval(interval, max time.Duration) time.Duration {
+	return m.asgBackoff.interval(interval, max)
+}
+
+func (m *Metadata) fetch(resc chan MetadataChannelResponse, errc chan MetadataChannelErrorResponse, path string, method func(string) (string, error), parser parsers.MetadataParser) {
 	body, err := method(path)
+	var update parsers.MetadataUpdate
+	if err == nil {
+		update, err = parser(body)
+	}
+	// A 404 is the metadata service telling us the data is gone, like a
+	// detached role or a released public IP, so whatever we had is evicted
+	// rather than served until the agent restarts.
+	if utils.IsNotFound(err) {
+		resc <- MetadataChannelResponse{
+			Path:    path,
+			Update:  parsers.Evict(path),
+			Missing: true,
+		}
+		return
+	}
 	if err != nil {
 		errc <- MetadataChannelErrorResponse{
 			Path: path,
@@ -89,13 +307,14 @@ func (m *Metadata) fetch(resc chan MetadataChannelResponse, errc chan MetadataCh
 		}
 		return
 	}
-	parser(body)
 	resc <- MetadataChannelResponse{
-		Path: path,
-		Body: body,
+		Path:   path,
+		Body:   body,
+		Update: update,
 	}
 }
 
+// Properties returns the current metadata snapshot, which must not be modified.
 func (m *Metadata) Properties() *parsers.MetadataProperties {
 	return m.parser.Properties()
 }
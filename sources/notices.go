@@ -0,0 +1,97 @@
+package sources
+
+import (
+	"time"
+
+	"github.com/davepgreene/propsd-agent/events"
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// noticePaths are polled on their own schedule. Each is missing until there's
+// something to say, so a 404 is the usual answer rather than an error.
+var noticePaths = []string{
+	parsers.SpotInstanceActionPath,
+	parsers.ScheduledEventsPath,
+	parsers.TargetLifecycleStatePath,
+}
+
+// Notices refreshes the spot interruption, scheduled maintenance and target
+// lifecycle state notices, and publishes an event for each one that's new.
+func (m *Metadata) Notices() {
+	resc, errc := make(chan MetadataChannelResponse, len(noticePaths)), make(chan MetadataChannelErrorResponse, len(noticePaths))
+	for _, path := range noticePaths {
+		go m.fetch(resc, errc, path, m.client.GetMetadata, m.parser.Parsers[path])
+	}
+
+	var lastErr error
+	throttled := true
+	updates := make([]parsers.MetadataUpdate, 0, len(noticePaths))
+	for range noticePaths {
+		select {
+		case res := <-resc:
+			updates = append(updates, res.Update)
+		case err := <-errc:
+			throttled = utils.AwsServiceError(m.client.ServiceName, err.Path, err.Error) && throttled
+			lastErr = err.Error
+		}
+	}
+
+	before := m.Properties()
+	m.parser.Update(updates...)
+	publishNotices(before, m.Properties())
+
+	switch {
+	case lastErr == nil:
+		m.noticesStatus.Success()
+	case throttled:
+		m.noticesStatus.Throttled(lastErr)
+	default:
+		m.noticesStatus.Degraded(lastErr)
+	}
+}
+
+// publishNotices publishes an event for each notice in after that wasn't in
+// before. Only active maintenance counts, and an instance already in service
+// when it's first seen hasn't been told anything new.
+func publishNotices(before, after *parsers.MetadataProperties) {
+	if spot := after.SpotInstanceAction; spot != nil && (before.SpotInstanceAction == nil || *before.SpotInstanceAction != *spot) {
+		events.Publish("spot-interruption", map[string]string{
+			"instance-id": after.InstanceID,
+			"action":      spot.Action,
+			"time":        spot.Time.Format(time.RFC3339),
+		})
+	}
+
+	active := make(map[string]bool)
+	for _, e := range before.ScheduledEvents {
+		if e.State == "active" {
+			active[e.EventID] = true
+		}
+	}
+	for _, e := range after.ScheduledEvents {
+		if e.State != "active" || active[e.EventID] {
+			continue
+		}
+		events.Publish("scheduled-event", map[string]string{
+			"instance-id": after.InstanceID,
+			"event-id":    e.EventID,
+			"code":        e.Code,
+			"description": e.Description,
+			"not-before":  e.NotBefore,
+			"not-after":   e.NotAfter,
+		})
+	}
+
+	from, to := before.TargetLifecycleState, after.TargetLifecycleState
+	if to != from && to != "" && !(from == "" && to == "InService") {
+		events.Publish("target-lifecycle-state", map[string]string{
+			"instance-id": after.InstanceID,
+			"from":        from,
+			"to":          to,
+		})
+	}
+
+	log.Debug("Checked instance notices")
+}
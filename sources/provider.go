@@ -0,0 +1,213 @@
+package sources
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davepgreene/propsd-agent/parsers"
+	"github.com/davepgreene/propsd-agent/status"
+	log "github.com/sirupsen/logrus"
+)
+
+// MetadataProvider reads instance metadata from a cloud's metadata service
+// into the common MetadataProperties schema.
+type MetadataProvider interface {
+	// Name is one of the parsers.Provider constants.
+	Name() string
+	// Get refreshes the metadata.
+	Get()
+	// Properties returns the current snapshot, which must not be modified.
+	Properties() *parsers.MetadataProperties
+	Ok() bool
+}
+
+// providerTimeout bounds each request to a metadata service when
+// metadata.timeout isn't set. It matches the EC2 metadata client's default.
+const providerTimeout = 5 * time.Second
+
+// documentProvider reads everything from a single document, which is how the
+// GCE and Azure metadata services are best queried.
+type documentProvider struct {
+	name   string
+	url    string
+	header http.Header
+	client http.Client
+	parser *parsers.Metadata
+	status *status.Component
+}
+
+// NewGCEProvider returns a provider for the GCE metadata server at host.
+func NewGCEProvider(host string, timeout time.Duration) MetadataProvider {
+	return newDocumentProvider(
+		parsers.ProviderGCE,
+		strings.TrimSuffix(host, "/")+"/computeMetadata/v1/?recursive=true&alt=json",
+		http.Header{"Metadata-Flavor": {"Google"}},
+		timeout,
+		parsers.NewGCEMetadataParser(),
+	)
+}
+
+// NewAzureProvider returns a provider for the Azure instance metadata service
+// at host, using the given API version.
+func NewAzureProvider(host, version string, timeout time.Duration) MetadataProvider {
+	return newDocumentProvider(
+		parsers.ProviderAzure,
+		fmt.Sprintf("%s/metadata/instance?api-version=%s", strings.TrimSuffix(host, "/"), version),
+		http.Header{"Metadata": {"true"}},
+		timeout,
+		parsers.NewAzureMetadataParser(),
+	)
+}
+
+func newDocumentProvider(name, url string, header http.Header, timeout time.Duration, parser *parsers.Metadata) *documentProvider {
+	if timeout <= 0 {
+		timeout = providerTimeout
+	}
+
+	return &documentProvider{
+		name:   name,
+		url:    url,
+		header: header,
+		// Metadata services are link local and refuse proxied requests, so
+		// proxy settings from the environment are ignored.
+		client: http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{},
+		},
+		parser: parser,
+		status: status.Register("metadata"),
+	}
+}
+
+func (d *documentProvider) Name() string {
+	return d.name
+}
+
+func (d *documentProvider) Get() {
+	body, err := d.fetch()
+	var update parsers.MetadataUpdate
+	if err == nil {
+		update, err = d.parser.Parsers[d.name](body)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"provider": d.name,
+		}).Error("Unable to read instance metadata")
+		d.status.Failure(err)
+		return
+	}
+
+	log.Debugf("Parsed data from the %s metadata service", d.name)
+	d.parser.Update(update)
+	d.status.Success()
+}
+
+func (d *documentProvider) Properties() *parsers.MetadataProperties {
+	return d.parser.Properties()
+}
+
+func (d *documentProvider) Ok() bool {
+	return d.Properties().InstanceID != ""
+}
+
+func (d *documentProvider) fetch() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, d.url, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, values := range d.header {
+		req.Header[key] = values
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s metadata service returned %d", d.name, resp.StatusCode)
+	}
+
+	return string(body), nil
+}
+
+// SwitchableProvider passes everything on to the provider it was last set to.
+// It lets the agent start serving before the metadata services have answered
+// and switch to a provider found later without the handlers changing.
+type SwitchableProvider struct {
+	mu sync.RWMutex
+	p  MetadataProvider
+}
+
+// NewSwitchableProvider returns a SwitchableProvider that starts out as p.
+func NewSwitchableProvider(p MetadataProvider) *SwitchableProvider {
+	return &SwitchableProvider{p: p}
+}
+
+// Set switches to p.
+func (s *SwitchableProvider) Set(p MetadataProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.p = p
+}
+
+// Provider returns the provider currently in use.
+func (s *SwitchableProvider) Provider() MetadataProvider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.p
+}
+
+func (s *SwitchableProvider) Name() string {
+	return s.Provider().Name()
+}
+
+func (s *SwitchableProvider) Get() {
+	s.Provider().Get()
+}
+
+func (s *SwitchableProvider) Properties() *parsers.MetadataProperties {
+	return s.Provider().Properties()
+}
+
+func (s *SwitchableProvider) Ok() bool {
+	return s.Provider().Ok()
+}
+
+// noMetadata stands in for a metadata provider where there's no metadata
+// service, like on bare metal. It always serves an empty document.
+type noMetadata struct {
+	properties *parsers.MetadataProperties
+}
+
+// NoMetadata returns a provider that never has any metadata.
+func NoMetadata() MetadataProvider {
+	return &noMetadata{properties: &parsers.MetadataProperties{}}
+}
+
+func (n *noMetadata) Name() string {
+	return parsers.ProviderNone
+}
+
+func (n *noMetadata) Get() {}
+
+func (n *noMetadata) Properties() *parsers.MetadataProperties {
+	return n.properties
+}
+
+// Ok is always true, because there's no metadata to be missing.
+func (n *noMetadata) Ok() bool {
+	return true
+}
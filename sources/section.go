@@ -0,0 +1,9 @@
+package sources
+
+// Section is a source that adds a top-level key to the document sent upstream,
+// next to the instance metadata.
+type Section interface {
+	Key() string
+	// Value returns the section's contents, or nil to leave it out.
+	Value() interface{}
+}
@@ -0,0 +1,157 @@
+package status
+
+import (
+	"sync"
+	"time"
+)
+
+// State describes the health of a component.
+type State string
+
+const (
+	// StatePending is reported for a component that hasn't been refreshed yet.
+	StatePending State = "pending"
+	// StateOK is reported when the most recent refresh succeeded.
+	StateOK State = "ok"
+	// StateDegraded is reported when the most recent refresh was incomplete or
+	// failed but previously fetched data is still being served.
+	StateDegraded State = "degraded"
+	// StateFailed is reported when a component has never refreshed successfully.
+	StateFailed State = "failed"
+	// StateThrottled is reported when the most recent refresh was refused
+	// because the agent is calling an API too often. Previously fetched data,
+	// if any, is still being served.
+	StateThrottled State = "throttled"
+	// StateDisabled is reported for a component that doesn't apply where the
+	// agent runs and is never refreshed.
+	StateDisabled State = "disabled"
+)
+
+// Report is the point-in-time view of a single component.
+type Report struct {
+	State       State      `json:"state"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	Age         string     `json:"age,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// Component tracks the outcome of refreshes for one data source.
+type Component struct {
+	mu          sync.RWMutex
+	state       State
+	lastSuccess time.Time
+	lastError   string
+	reason      string
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]*Component)
+)
+
+// Register returns the component with the given name, creating it if it
+// doesn't exist yet.
+func Register(name string) *Component {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if c, ok := registry[name]; ok {
+		return c
+	}
+
+	c := &Component{state: StatePending}
+	registry[name] = c
+
+	return c
+}
+
+// Reports returns a snapshot of every registered component keyed by name.
+func Reports() map[string]Report {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	reports := make(map[string]Report, len(registry))
+	for name, c := range registry {
+		reports[name] = c.Report()
+	}
+
+	return reports
+}
+
+// Success records a complete refresh.
+func (c *Component) Success() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reason = ""
+	c.state = StateOK
+	c.lastSuccess = time.Now()
+}
+
+// Degraded records a refresh that produced data but hit err along the way.
+func (c *Component) Degraded(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reason = ""
+	c.state = StateDegraded
+	c.lastSuccess = time.Now()
+	c.lastError = err.Error()
+}
+
+// Failure records a refresh that produced no data. If an earlier refresh
+// succeeded its data is still served, so the component is only degraded.
+func (c *Component) Failure(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reason = ""
+	c.lastError = err.Error()
+	if c.lastSuccess.IsZero() {
+		c.state = StateFailed
+	} else {
+		c.state = StateDegraded
+	}
+}
+
+// Throttled records a refresh that was refused with err because the agent is
+// calling an API too often.
+func (c *Component) Throttled(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reason = ""
+	c.state = StateThrottled
+	c.lastError = err.Error()
+}
+
+// Disable records that the component won't be refreshed, and why. A later
+// refresh, if the source turns out to apply after all, clears the reason.
+func (c *Component) Disable(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = StateDisabled
+	c.reason = reason
+}
+
+// Report returns the current state of the component.
+func (c *Component) Report() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	r := Report{
+		State:     c.state,
+		LastError: c.lastError,
+		Reason:    c.reason,
+	}
+
+	if !c.lastSuccess.IsZero() {
+		lastSuccess := c.lastSuccess
+		r.LastSuccess = &lastSuccess
+		r.Age = time.Since(lastSuccess).Truncate(time.Second).String()
+	}
+
+	return r
+}
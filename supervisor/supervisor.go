@@ -0,0 +1,119 @@
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Child runs a command and restarts or signals it on request.
+type Child struct {
+	args   []string
+	cmd    *exec.Cmd
+	exited chan error
+
+	// StopTimeout is how long Restart waits after SIGTERM before killing
+	// the child.
+	StopTimeout time.Duration
+}
+
+// New returns a Child for args. The command isn't started until Start is
+// called.
+func New(args []string) *Child {
+	return &Child{
+		args:        args,
+		StopTimeout: 10 * time.Second,
+	}
+}
+
+// Start runs the command with env, sharing the agent's stdio.
+func (c *Child) Start(env []string) error {
+	cmd := exec.Command(c.args[0], c.args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	c.cmd = cmd
+	c.exited = exited
+
+	log.WithFields(log.Fields{
+		"command": c.args[0],
+		"pid":     cmd.Process.Pid,
+	}).Info("Started child process")
+
+	return nil
+}
+
+// Exited receives the result of the running child's Wait.
+func (c *Child) Exited() <-chan error {
+	return c.exited
+}
+
+// Signal sends sig to the running child.
+func (c *Child) Signal(sig os.Signal) error {
+	if c.cmd == nil || c.cmd.Process == nil {
+		return nil
+	}
+
+	return c.cmd.Process.Signal(sig)
+}
+
+// Restart stops the running child and starts it again with env. If the new
+// child can't be started, the error is also what Exited receives.
+func (c *Child) Restart(env []string) error {
+	log.WithFields(log.Fields{
+		"command": c.args[0],
+	}).Info("Restarting child process")
+
+	c.Signal(syscall.SIGTERM)
+
+	select {
+	case <-c.exited:
+	case <-time.After(c.StopTimeout):
+		log.Warn("Child process didn't stop in time. Killing it.")
+		c.Signal(syscall.SIGKILL)
+		<-c.exited
+	}
+
+	if err := c.Start(env); err != nil {
+		// Nothing's running any more, so Exited reports why.
+		c.cmd = nil
+		c.exited = make(chan error, 1)
+		c.exited <- err
+		return err
+	}
+
+	return nil
+}
+
+// ExitCode converts the error returned by Wait into a process exit code,
+// using the shell convention of 128+n for a child killed by signal n.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			if status.Signaled() {
+				return 128 + int(status.Signal())
+			}
+			return status.ExitStatus()
+		}
+	}
+
+	return 1
+}
@@ -1,9 +1,13 @@
 package utils
 
 import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/davepgreene/propsd-agent/config"
 	"github.com/spf13/viper"
+	"net/http"
 	"net/url"
 	log "github.com/sirupsen/logrus"
 )
@@ -26,11 +30,49 @@ func CreateMetadataClient(c client.Config) *ec2metadata.EC2Metadata {
 			}
 		}, func(client *client.Client) {
 			if viper.IsSet("metadata.timeout") {
-				client.Config.HTTPClient.Timeout = viper.GetDuration("metadata.timeout")
+				client.Config.HTTPClient.Timeout = config.GetDuration("metadata.timeout")
 			}
+		}, func(client *client.Client) {
+			// The ec2metadata client drops the response status, which we need to
+			// tell a missing path apart from a failed request.
+			client.Handlers.UnmarshalError.PushBack(func(r *request.Request) {
+				if err, ok := r.Error.(awserr.Error); ok {
+					r.Error = awserr.NewRequestFailure(err, r.HTTPResponse.StatusCode, r.RequestID)
+				}
+			})
 		})
 }
 
-func AwsServiceError(service string, path string, err error) {
+// IsNotFound reports whether err is the metadata service saying a path
+// doesn't exist, which means whatever it used to hold is gone.
+func IsNotFound(err error) bool {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusNotFound
+	}
+	return false
+}
+
+// IsThrottled reports whether err is AWS refusing a request because the
+// caller is making too many.
+func IsThrottled(err error) bool {
+	if request.IsErrorThrottle(err) {
+		return true
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return reqErr.StatusCode() == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// AwsServiceError logs an error from an AWS service and reports whether it was
+// throttling, which callers should back off from rather than retry on their
+// usual schedule.
+func AwsServiceError(service string, path string, err error) bool {
+	if IsThrottled(err) {
+		log.Warnf("Aws-sdk throttled the %s service request to %s: %v", service, path, err)
+		return true
+	}
+
 	log.Errorf("Aws-sdk returned the following error during the %s service request to %s: %v", service, path, err)
+	return false
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Limiter is a token bucket. Tokens are added at rate per second up to burst,
+// and each request takes one, waiting for it if the bucket is empty.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a full bucket.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// apiLimiter is shared by every AWS API call the agent makes, so however many
+// jobs and refreshes run at once the agent's calls stay within its budget.
+var apiLimiter = NewLimiter(1, 5)
+
+// SetAPIRateLimit changes the rate and burst of AWS API calls.
+func SetAPIRateLimit(rate float64, burst int) {
+	apiLimiter.Set(rate, burst)
+}
+
+// RateLimited makes every request c sends, including retries, wait for the
+// shared AWS API limiter.
+func RateLimited(c *client.Client) {
+	c.Handlers.Send.PushFront(func(r *request.Request) {
+		apiLimiter.Wait()
+	})
+}
+
+// Set changes the rate and burst, keeping the tokens already in the bucket.
+func (l *Limiter) Set(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = rate
+	l.burst = float64(burst)
+	l.tokens = math.Min(l.tokens, l.burst)
+}
+
+// Wait takes a token, blocking until one is available. Callers waiting
+// together are served in the order they arrived.
+func (l *Limiter) Wait() {
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+	// Taking the token now, even if that leaves the bucket in debt, reserves
+	// it so later callers queue up behind this one.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 && l.rate > 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (l *Limiter) refill(now time.Time) {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}